@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	jwtmiddleware "github.com/auth0/go-jwt-middleware/v2"
+	"github.com/stretchr/testify/assert"
+	"heroes.rainerstropek.com/internal/data"
+	"heroes.rainerstropek.com/internal/jwttest"
+	"heroes.rainerstropek.com/internal/middleware"
+)
+
+// newTestServer runs the full API with an in-memory repository. It accepts
+// tokens minted with jwttest.
+func newTestServer(t *testing.T) (*application, *httptest.Server) {
+	app := newTestApplication(nil)
+	app.models = data.NewMemoryModels()
+
+	var err error
+	app.jwt, err = middleware.NewJwtMiddleware(jwttest.Config(), jwtmiddleware.WithErrorHandler(app.jwtErrorHandler))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewServer(testRoutes(t, app))
+	t.Cleanup(ts.Close)
+
+	return app, ts
+}
+
+// testRoutes returns the routes of app. Their background work stops at the
+// end of the test.
+func testRoutes(t *testing.T, app *application) http.Handler {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	return app.routes(ctx)
+}
+
+func mintTestToken(t *testing.T, scope string, roles ...string) string {
+	token, err := jwttest.Mint("test-user", middleware.CustomClaimsExample{Scope: scope, Roles: roles})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return token
+}
+
+func doRequest(t *testing.T, ts *httptest.Server, method, path, token, body string, headers ...string) *http.Response {
+	r, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	for i := 0; i+1 < len(headers); i += 2 {
+		r.Header.Set(headers[i], headers[i+1])
+	}
+
+	rs, err := ts.Client().Do(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { rs.Body.Close() })
+
+	return rs
+}
+
+func TestRouteAuthorization(t *testing.T) {
+	_, ts := newTestServer(t)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		status int
+	}{
+		{"no token", http.MethodGet, "/v1/heroes", "", http.StatusUnauthorized},
+		{"invalid token", http.MethodGet, "/v1/heroes", "not-a-jwt", http.StatusUnauthorized},
+		{"read scope", http.MethodGet, "/v1/heroes", mintTestToken(t, "Heroes.Read"), http.StatusOK},
+		{"read role", http.MethodGet, "/v1/heroes", mintTestToken(t, "", "Heroes.Read"), http.StatusOK},
+		{"write without read", http.MethodGet, "/v1/heroes", mintTestToken(t, "Heroes.Write"), http.StatusForbidden},
+		{"read cannot write", http.MethodPost, "/v1/heroes", mintTestToken(t, "Heroes.Read"), http.StatusForbidden},
+		{"write cannot delete", http.MethodDelete, "/v1/heroes/1", mintTestToken(t, "Heroes.Read Heroes.Write"), http.StatusForbidden},
+		{"admin can delete", http.MethodDelete, "/v1/heroes/1", mintTestToken(t, "", "Admin"), http.StatusNotFound},
+		{"read cannot list deleted", http.MethodGet, "/v1/heroes?include_deleted=true", mintTestToken(t, "Heroes.Read"), http.StatusForbidden},
+		{"admin can list deleted", http.MethodGet, "/v1/heroes?include_deleted=true", mintTestToken(t, "", "Admin"), http.StatusOK},
+		{"write can restore", http.MethodPost, "/v1/heroes/1/restore", mintTestToken(t, "Heroes.Write"), http.StatusNotFound},
+		{"write cannot purge", http.MethodPost, "/v1/heroes/1/purge", mintTestToken(t, "Heroes.Read Heroes.Write"), http.StatusForbidden},
+		{"admin can purge", http.MethodPost, "/v1/heroes/1/purge", mintTestToken(t, "", "Admin"), http.StatusNotFound},
+		{"read cannot import", http.MethodPost, "/v1/heroes:import", mintTestToken(t, "Heroes.Read"), http.StatusForbidden},
+		{"write cannot export", http.MethodGet, "/v1/heroes:export", mintTestToken(t, "Heroes.Write"), http.StatusForbidden},
+		{"no token for export", http.MethodGet, "/v1/heroes:export", "", http.StatusUnauthorized},
+		{"write cannot generate", http.MethodPost, "/v1/generate", mintTestToken(t, "Heroes.Write"), http.StatusForbidden},
+		{"claims for any token", http.MethodGet, "/v1/claims", mintTestToken(t, ""), http.StatusOK},
+		{"read can list teams", http.MethodGet, "/v1/teams", mintTestToken(t, "Heroes.Read"), http.StatusOK},
+		{"read cannot create teams", http.MethodPost, "/v1/teams", mintTestToken(t, "Heroes.Read"), http.StatusForbidden},
+		{"write cannot delete teams", http.MethodDelete, "/v1/teams/1", mintTestToken(t, "Heroes.Read Heroes.Write"), http.StatusForbidden},
+		{"write can add members", http.MethodPut, "/v1/teams/1/members/1", mintTestToken(t, "Heroes.Write"), http.StatusNotFound},
+		{"read cannot add rivals", http.MethodPut, "/v1/heroes/1/rivals/2", mintTestToken(t, "Heroes.Read"), http.StatusForbidden},
+		{"no token for v2", http.MethodGet, "/v2/heroes", "", http.StatusUnauthorized},
+		{"read cannot write v2", http.MethodPut, "/v2/heroes/1", mintTestToken(t, "Heroes.Read"), http.StatusForbidden},
+		{"write cannot delete v2", http.MethodDelete, "/v2/heroes/1", mintTestToken(t, "Heroes.Read Heroes.Write"), http.StatusForbidden},
+		{"read cannot import v2", http.MethodPost, "/v2/heroes:import", mintTestToken(t, "Heroes.Read"), http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs := doRequest(t, ts, tt.method, tt.path, tt.token, "")
+			assert.Equal(t, tt.status, rs.StatusCode)
+		})
+	}
+}
+
+func TestHeroesEndToEnd(t *testing.T) {
+	_, ts := newTestServer(t)
+	token := mintTestToken(t, "Heroes.Read Heroes.Write")
+
+	rs := doRequest(t, ts, http.MethodPost, "/v1/heroes", token,
+		`{"name": "Superman", "firstSeen": "1938-04-18T00:00:00Z", "canFly": true, "abilities": ["super strong"]}`)
+	assert.Equal(t, http.StatusCreated, rs.StatusCode)
+
+	rs = doRequest(t, ts, http.MethodGet, "/v1/heroes/1", token, "")
+	assert.Equal(t, http.StatusOK, rs.StatusCode)
+	etag := rs.Header.Get("ETag")
+	assert.Equal(t, `"1"`, etag)
+
+	rs = doRequest(t, ts, http.MethodPatch, "/v1/heroes/1", token, `{"realName": "Clark Kent"}`, "If-Match", etag)
+	assert.Equal(t, http.StatusOK, rs.StatusCode)
+
+	rs = doRequest(t, ts, http.MethodPatch, "/v1/heroes/1", token, `{"realName": "Kal-El"}`, "If-Match", etag)
+	assert.Equal(t, http.StatusPreconditionFailed, rs.StatusCode)
+
+	rs = doRequest(t, ts, http.MethodGet, "/v1/heroes?name=super", token, "")
+	assert.Equal(t, http.StatusOK, rs.StatusCode)
+
+	var list struct {
+		Metadata data.Metadata `json:"metadata"`
+		Heroes   []struct {
+			RealName string `json:"realName"`
+			Version  int    `json:"version"`
+		} `json:"heroes"`
+	}
+	err := json.NewDecoder(rs.Body).Decode(&list)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, 1, list.Metadata.TotalRecords)
+	assert.Equal(t, "Clark Kent", list.Heroes[0].RealName)
+	assert.Equal(t, 2, list.Heroes[0].Version)
+
+	rs = doRequest(t, ts, http.MethodGet, "/v1/heroes/1/history", token, "")
+	assert.Equal(t, http.StatusOK, rs.StatusCode)
+
+	var history struct {
+		Events []data.AuditEvent `json:"events"`
+	}
+	err = json.NewDecoder(rs.Body).Decode(&history)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Len(t, history.Events, 2)
+	assert.Equal(t, data.AuditActionUpdate, history.Events[0].Action)
+	assert.Equal(t, "test-user", history.Events[0].Actor)
+	assert.Equal(t, "Clark Kent", history.Events[0].Changes["realName"].New)
+
+	rs = doRequest(t, ts, http.MethodGet, "/v1/heroes/2/history", token, "")
+	assert.Equal(t, http.StatusNotFound, rs.StatusCode)
+}
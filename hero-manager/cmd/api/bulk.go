@@ -0,0 +1,433 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"heroes.rainerstropek.com/internal/data"
+	"heroes.rainerstropek.com/internal/middleware"
+	"heroes.rainerstropek.com/internal/validator"
+)
+
+const (
+	// Number of heroes stored in a single transaction during imports
+	importBatchSize = 100
+
+	// Limits of import request bodies and NDJSON lines
+	maxImportBytes     = 32 << 20
+	maxImportLineBytes = 1 << 20
+)
+
+// heroCSVColumns are the columns of CSV exports. Imports accept any subset of
+// them in any order, id, version and deletedAt are ignored.
+var heroCSVColumns = []string{"id", "name", "firstSeen", "canFly", "realName", "abilities", "version", "deletedAt"}
+
+// importRecord is a single hero of an import. Abilities can be given as a
+// JSON array or, like in exports, as a comma-separated string.
+type importRecord struct {
+	Name      string      `json:"name"`
+	FirstSeen time.Time   `json:"firstSeen"`
+	CanFly    bool        `json:"canFly"`
+	RealName  string      `json:"realName"`
+	Abilities abilityList `json:"abilities"`
+
+	// Read-only fields of exported heroes are accepted, but ignored
+	ID        json.RawMessage `json:"id"`
+	Version   json.RawMessage `json:"version"`
+	DeletedAt json.RawMessage `json:"deletedAt"`
+}
+
+type abilityList []string
+
+func (a *abilityList) UnmarshalJSON(js []byte) error {
+	if bytes.HasPrefix(js, []byte(`"`)) {
+		var s string
+		if err := json.Unmarshal(js, &s); err != nil {
+			return err
+		}
+
+		*a = splitAbilities(s)
+		return nil
+	}
+
+	return json.Unmarshal(js, (*[]string)(a))
+}
+
+// splitAbilities parses abilities in the format of Hero.MarshalJSON.
+func splitAbilities(s string) []string {
+	abilities := []string{}
+	for _, ability := range strings.Split(s, ",") {
+		if ability = strings.TrimSpace(ability); ability != "" {
+			abilities = append(abilities, ability)
+		}
+	}
+
+	return abilities
+}
+
+// importLineError reports why a line of an import has been skipped.
+type importLineError struct {
+	Line   int               `json:"line"`
+	Errors map[string]string `json:"errors"`
+}
+
+func (e *importLineError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Errors)
+}
+
+// heroDecoder reads the records of an import one at a time. Next returns
+// io.EOF after the last record and an *importLineError for a record that
+// cannot be parsed. All other errors end the import.
+type heroDecoder interface {
+	Next() (record *importRecord, line int, err error)
+}
+
+type ndjsonDecoder struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func newNDJSONDecoder(r io.Reader) *ndjsonDecoder {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxImportLineBytes)
+	return &ndjsonDecoder{scanner: scanner}
+}
+
+func (d *ndjsonDecoder) Next() (*importRecord, int, error) {
+	for d.scanner.Scan() {
+		d.line++
+
+		js := bytes.TrimSpace(d.scanner.Bytes())
+		if len(js) == 0 {
+			continue
+		}
+
+		dec := json.NewDecoder(bytes.NewReader(js))
+		dec.DisallowUnknownFields()
+
+		var record importRecord
+		err := dec.Decode(&record)
+		if err == nil && dec.More() {
+			err = errors.New("line must only contain a single JSON value")
+		}
+		if err != nil {
+			return nil, d.line, &importLineError{Line: d.line, Errors: map[string]string{"record": err.Error()}}
+		}
+
+		return &record, d.line, nil
+	}
+
+	if err := d.scanner.Err(); err != nil {
+		return nil, d.line + 1, err
+	}
+
+	return nil, d.line, io.EOF
+}
+
+type csvDecoder struct {
+	reader  *csv.Reader
+	columns []string
+}
+
+// newCSVDecoder reads the header row naming the columns of the records.
+func newCSVDecoder(r io.Reader) (*csvDecoder, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	columns, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("CSV header row: %w", err)
+	}
+
+	for _, column := range columns {
+		if !validator.In(column, heroCSVColumns...) {
+			return nil, fmt.Errorf("CSV header row contains unknown column %q", column)
+		}
+	}
+
+	return &csvDecoder{reader: reader, columns: columns}, nil
+}
+
+func (d *csvDecoder) Next() (*importRecord, int, error) {
+	values, err := d.reader.Read()
+	if err != nil && !errors.Is(err, csv.ErrFieldCount) {
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			return nil, parseErr.Line, err
+		}
+
+		return nil, 0, err
+	}
+
+	line, _ := d.reader.FieldPos(0)
+	if err != nil {
+		return nil, line, &importLineError{Line: line, Errors: map[string]string{"record": err.Error()}}
+	}
+
+	var record importRecord
+	errs := make(map[string]string)
+	for i, column := range d.columns {
+		value := values[i]
+		switch column {
+		case "name":
+			record.Name = value
+		case "firstSeen":
+			if value != "" {
+				record.FirstSeen, err = time.Parse(time.RFC3339, value)
+				if err != nil {
+					errs[column] = "must be an RFC 3339 timestamp"
+				}
+			}
+		case "canFly":
+			if value != "" {
+				record.CanFly, err = strconv.ParseBool(value)
+				if err != nil {
+					errs[column] = "must be a boolean value"
+				}
+			}
+		case "realName":
+			record.RealName = value
+		case "abilities":
+			record.Abilities = splitAbilities(value)
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, line, &importLineError{Line: line, Errors: errs}
+	}
+
+	return &record, line, nil
+}
+
+// clearDeadlines removes the server's read and write timeouts for a bulk
+// request, which can take longer than ordinary requests. Writers that cannot
+// set deadlines (e.g. in tests) have no timeouts to remove.
+func (app *application) clearDeadlines(w http.ResponseWriter, r *http.Request) {
+	rc := http.NewResponseController(w)
+	for _, err := range []error{rc.SetReadDeadline(time.Time{}), rc.SetWriteDeadline(time.Time{})} {
+		if err != nil && !errors.Is(err, http.ErrNotSupported) {
+			app.logError(r, err)
+		}
+	}
+}
+
+// importHeroesHandler stores the heroes of an NDJSON or CSV request body.
+// Valid heroes are stored in batches, each in a single transaction, invalid
+// ones are skipped and reported by line number. If the body cannot be read
+// any further or a batch cannot be stored, the import stops and the error is
+// reported for the line (range). The heroes stored so far are kept.
+func (app *application) importHeroesHandler(w http.ResponseWriter, r *http.Request) {
+	app.clearDeadlines(w, r)
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportBytes)
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	var dec heroDecoder
+	switch mediaType {
+	case "application/x-ndjson", "application/ndjson":
+		dec = newNDJSONDecoder(r.Body)
+	case "text/csv":
+		csvDec, err := newCSVDecoder(r.Body)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		dec = csvDec
+	default:
+		app.unsupportedMediaTypeResponse(w, r, "application/x-ndjson", "text/csv")
+		return
+	}
+
+	report := struct {
+		Imported int               `json:"imported"`
+		Skipped  int               `json:"skipped"`
+		Errors   []importLineError `json:"errors"`
+	}{Errors: []importLineError{}}
+
+	// Lines of the first and last hero of the batch
+	batch := []*data.Hero{}
+	var firstLine, lastLine int
+	stored := true
+	flush := func() bool {
+		if len(batch) == 0 {
+			return true
+		}
+
+		err := app.models.Heroes.InsertMany(r.Context(), batch)
+		if err != nil {
+			app.logError(r, err)
+			report.Errors = append(report.Errors, importLineError{Line: firstLine, Errors: map[string]string{
+				"body": fmt.Sprintf("the heroes of lines %d to %d could not be stored, the import has stopped", firstLine, lastLine),
+			}})
+			return false
+		}
+
+		report.Imported += len(batch)
+		batch = []*data.Hero{}
+		return true
+	}
+
+	for {
+		record, line, err := dec.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			var lineErr *importLineError
+			if errors.As(err, &lineErr) {
+				report.Skipped++
+				report.Errors = append(report.Errors, *lineErr)
+				continue
+			}
+
+			report.Errors = append(report.Errors, importLineError{Line: line, Errors: map[string]string{"body": err.Error()}})
+			break
+		}
+
+		hero := &data.Hero{
+			Name:      record.Name,
+			FirstSeen: record.FirstSeen,
+			CanFly:    record.CanFly,
+			RealName:  record.RealName,
+			Abilities: record.Abilities,
+		}
+
+		v := validator.New()
+		if data.ValidateHero(v, hero); !v.Valid() {
+			report.Skipped++
+			report.Errors = append(report.Errors, importLineError{Line: line, Errors: v.Errors})
+			continue
+		}
+
+		if len(batch) == 0 {
+			firstLine = line
+		}
+		batch = append(batch, hero)
+		lastLine = line
+
+		if len(batch) == importBatchSize {
+			if stored = flush(); !stored {
+				break
+			}
+		}
+	}
+
+	if stored {
+		flush()
+	}
+
+	err := app.writeJSON(w, http.StatusOK, report, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// exportHeroesHandler streams all heroes matching the list filters as NDJSON
+// (default) or CSV. Heroes are written while they are read from the
+// database, so the result set is never held in memory.
+func (app *application) exportHeroesHandler(w http.ResponseWriter, r *http.Request) {
+	app.clearDeadlines(w, r)
+
+	var input struct {
+		data.HeroFilter
+		data.Filters
+		Format string
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+	input.HeroFilter = app.readHeroFilter(qs, v)
+	input.Filters.Sort = app.readString(qs, "sort", defaultHeroSort(input.HeroFilter))
+	input.Filters.SortSafelist = heroSortSafelist
+	input.Format = app.readString(qs, "format", "ndjson")
+
+	v.Check(validator.In(input.Format, "ndjson", "csv"), "format", "must be ndjson or csv")
+	data.ValidateHeroFilter(v, input.HeroFilter, input.Filters)
+	if data.ValidateSort(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Only admins can see deleted heroes
+	if input.IncludeDeleted && !middleware.HasPermission(r, middleware.PermissionAdmin) {
+		app.forbiddenResponse(w, r, middleware.PermissionAdmin)
+		return
+	}
+
+	var (
+		write  func(hero *data.Hero) error
+		finish = func() error { return nil }
+	)
+
+	switch input.Format {
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="heroes.csv"`)
+
+		cw := csv.NewWriter(w)
+		cw.Write(heroCSVColumns)
+		write = func(hero *data.Hero) error {
+			deletedAt := ""
+			if hero.DeletedAt != nil {
+				deletedAt = hero.DeletedAt.Format(time.RFC3339)
+			}
+
+			return cw.Write([]string{
+				strconv.FormatInt(hero.ID, 10),
+				hero.Name,
+				hero.FirstSeen.Format(time.RFC3339),
+				strconv.FormatBool(hero.CanFly),
+				hero.RealName,
+				strings.Join(hero.Abilities, ", "),
+				strconv.FormatInt(int64(hero.Version), 10),
+				deletedAt,
+			})
+		}
+		finish = func() error {
+			cw.Flush()
+			return cw.Error()
+		}
+	default:
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Content-Disposition", `attachment; filename="heroes.ndjson"`)
+
+		enc := json.NewEncoder(w)
+		write = func(hero *data.Hero) error {
+			return enc.Encode(heroResponse(r, hero))
+		}
+	}
+
+	// Once the first hero has been written, errors can no longer be reported
+	// to the client. The response is cut short instead.
+	written := false
+	err := app.models.Heroes.Stream(r.Context(), input.HeroFilter, input.Filters, func(hero *data.Hero) error {
+		written = true
+		return write(hero)
+	})
+	if err == nil {
+		err = finish()
+	}
+
+	switch {
+	case err == nil:
+	case !written:
+		w.Header().Del("Content-Disposition")
+		app.serverErrorResponse(w, r, err)
+	case errors.Is(err, context.Canceled):
+		app.clientClosedRequest(r, err)
+	default:
+		app.logError(r, err)
+	}
+}
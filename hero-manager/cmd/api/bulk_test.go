@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"heroes.rainerstropek.com/mocks"
+)
+
+type importReport struct {
+	Imported int               `json:"imported"`
+	Skipped  int               `json:"skipped"`
+	Errors   []importLineError `json:"errors"`
+}
+
+func decodeImportReport(t *testing.T, rs *http.Response) importReport {
+	var report importReport
+	err := json.NewDecoder(rs.Body).Decode(&report)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return report
+}
+
+func TestImportHeroesNDJSON(t *testing.T) {
+	_, ts := newTestServer(t)
+	token := mintTestToken(t, "Heroes.Read Heroes.Write")
+
+	body := strings.Join([]string{
+		`{"name": "Superman", "firstSeen": "1938-04-18T00:00:00Z", "canFly": true, "abilities": ["strength", "flight"]}`,
+		`{"name": "", "abilities": ["money"]}`,
+		``,
+		`{"name": "Batman", "abilities": "money, gadgets"}`,
+		`not json`,
+		`{"name": "Robin", "abilities": ["acrobatics"], "sidekick": true}`,
+	}, "\n")
+
+	rs := doRequest(t, ts, http.MethodPost, "/v1/heroes:import", token, body, "Content-Type", "application/x-ndjson")
+	assert.Equal(t, http.StatusOK, rs.StatusCode)
+
+	report := decodeImportReport(t, rs)
+	assert.Equal(t, 2, report.Imported)
+	assert.Equal(t, 3, report.Skipped)
+
+	lines := []int{}
+	for _, lineErr := range report.Errors {
+		lines = append(lines, lineErr.Line)
+	}
+	assert.Equal(t, []int{2, 5, 6}, lines)
+	assert.Equal(t, "must be provided", report.Errors[0].Errors["name"])
+
+	rs = doRequest(t, ts, http.MethodGet, "/v1/heroes?sort=name", token, "")
+	var list struct {
+		Heroes []struct {
+			Name      string `json:"name"`
+			Abilities string `json:"abilities"`
+		} `json:"heroes"`
+	}
+	err := json.NewDecoder(rs.Body).Decode(&list)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Len(t, list.Heroes, 2)
+	assert.Equal(t, "money, gadgets", list.Heroes[0].Abilities)
+}
+
+func TestImportHeroesStoreFailure(t *testing.T) {
+	repo := &mocks.HeroesRepository{}
+	repo.On("InsertMany", mock.Anything, mock.Anything).Return(nil).Once()
+	repo.On("InsertMany", mock.Anything, mock.Anything).Return(errors.New("connection reset")).Once()
+	app := newTestApplication(repo)
+
+	lines := []string{}
+	for i := 0; i < 2*importBatchSize+50; i++ {
+		lines = append(lines, fmt.Sprintf(`{"name": "Hero %d", "abilities": ["flight"]}`, i))
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/heroes:import", strings.NewReader(strings.Join(lines, "\n")))
+	r.Header.Set("Content-Type", "application/x-ndjson")
+	rr := httptest.NewRecorder()
+	app.importHeroesHandler(rr, r)
+
+	// The first batch has been stored, the import stops at the second one
+	assert.Equal(t, http.StatusOK, rr.Code)
+	repo.AssertNumberOfCalls(t, "InsertMany", 2)
+
+	var report importReport
+	err := json.NewDecoder(rr.Body).Decode(&report)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, importBatchSize, report.Imported)
+	if assert.Len(t, report.Errors, 1) {
+		assert.Equal(t, importBatchSize+1, report.Errors[0].Line)
+		assert.Contains(t, report.Errors[0].Errors["body"], "lines 101 to 200")
+	}
+}
+
+func TestImportHeroesCSV(t *testing.T) {
+	_, ts := newTestServer(t)
+	token := mintTestToken(t, "Heroes.Write")
+
+	body := "name,canFly,abilities,firstSeen\n" +
+		"Superman,true,\"strength, flight\",1938-04-18T00:00:00Z\n" +
+		"Batman,maybe,money,\n" +
+		"Wonder Woman\n" +
+		"Flash,false,speed,1940-01-01T00:00:00Z\n"
+
+	rs := doRequest(t, ts, http.MethodPost, "/v1/heroes:import", token, body, "Content-Type", "text/csv")
+	assert.Equal(t, http.StatusOK, rs.StatusCode)
+
+	report := decodeImportReport(t, rs)
+	assert.Equal(t, 2, report.Imported)
+	assert.Equal(t, 2, report.Skipped)
+	assert.Equal(t, 3, report.Errors[0].Line)
+	assert.Equal(t, "must be a boolean value", report.Errors[0].Errors["canFly"])
+	assert.Equal(t, 4, report.Errors[1].Line)
+
+	rs = doRequest(t, ts, http.MethodPost, "/v1/heroes:import", token, "name,power\n", "Content-Type", "text/csv")
+	assert.Equal(t, http.StatusBadRequest, rs.StatusCode)
+
+	rs = doRequest(t, ts, http.MethodPost, "/v1/heroes:import", token, "{}", "Content-Type", "application/json")
+	assert.Equal(t, http.StatusUnsupportedMediaType, rs.StatusCode)
+
+	rs = doRequest(t, ts, http.MethodGet, "/v1/heroes:import", token, "")
+	assert.Equal(t, http.StatusMethodNotAllowed, rs.StatusCode)
+}
+
+func TestExportHeroes(t *testing.T) {
+	_, ts := newTestServer(t)
+	token := mintTestToken(t, "Heroes.Read Heroes.Write")
+
+	body := `{"name": "Superman", "firstSeen": "1938-04-18T00:00:00Z", "canFly": true, "abilities": ["strength", "flight"]}
+{"name": "Batman", "firstSeen": "1939-05-01T00:00:00Z", "abilities": ["money"]}
+{"name": "Supergirl", "firstSeen": "1959-05-01T00:00:00Z", "canFly": true, "abilities": ["flight"]}`
+	rs := doRequest(t, ts, http.MethodPost, "/v1/heroes:import", token, body, "Content-Type", "application/x-ndjson")
+	assert.Equal(t, 3, decodeImportReport(t, rs).Imported)
+
+	rs = doRequest(t, ts, http.MethodGet, "/v1/heroes:export?abilities=flight&sort=-name", token, "")
+	assert.Equal(t, http.StatusOK, rs.StatusCode)
+	assert.Equal(t, "application/x-ndjson", rs.Header.Get("Content-Type"))
+
+	export, err := io.ReadAll(rs.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(export)), "\n")
+	assert.Len(t, lines, 2)
+	assert.Contains(t, lines[0], `"name":"Superman"`)
+	assert.Contains(t, lines[1], `"name":"Supergirl"`)
+
+	// Exports can be imported again
+	rs = doRequest(t, ts, http.MethodPost, "/v1/heroes:import", token, string(export), "Content-Type", "application/x-ndjson")
+	assert.Equal(t, 2, decodeImportReport(t, rs).Imported)
+
+	rs = doRequest(t, ts, http.MethodGet, "/v1/heroes:export?format=csv&name=bat", token, "")
+	assert.Equal(t, http.StatusOK, rs.StatusCode)
+	assert.Equal(t, "text/csv", rs.Header.Get("Content-Type"))
+
+	records, err := csv.NewReader(rs.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, [][]string{
+		heroCSVColumns,
+		{"2", "Batman", "1939-05-01T00:00:00Z", "false", "", "money", "1", ""},
+	}, records)
+
+	rs = doRequest(t, ts, http.MethodGet, "/v1/heroes:export?format=xml", token, "")
+	assert.Equal(t, http.StatusUnprocessableEntity, rs.StatusCode)
+
+	rs = doRequest(t, ts, http.MethodGet, "/v1/heroes:export?include_deleted=true", token, "")
+	assert.Equal(t, http.StatusForbidden, rs.StatusCode)
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"net/http"
+
+	"heroes.rainerstropek.com/internal/middleware"
+)
+
+// showClaimsHandler returns the validated claims of the caller's token.
+func (app *application) showClaimsHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := middleware.Claims(r)
+	if !ok {
+		app.invalidAuthenticationTokenResponse(w, r)
+		return
+	}
+
+	err := app.writeJSON(w, http.StatusOK, claims, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+)
+
+// Responses with a known length below this size are sent uncompressed, the
+// overhead of the encoding would outweigh the savings.
+const minCompressSize = 1024
+
+// compressibleTypes are the media types that are compressed. Other responses
+// (e.g. already compressed ones) are sent as they are.
+var compressibleTypes = map[string]bool{
+	"application/json":         true,
+	"application/problem+json": true,
+	"application/x-ndjson":     true,
+	"text/csv":                 true,
+	"text/plain":               true,
+}
+
+// Encoders are reused, creating them allocates large buffers.
+var encoderPools = map[string]*sync.Pool{
+	"br": {New: func() interface{} {
+		return brotli.NewWriterLevel(io.Discard, brotli.DefaultCompression)
+	}},
+	"gzip": {New: func() interface{} {
+		return gzip.NewWriter(io.Discard)
+	}},
+}
+
+// encoder is implemented by gzip.Writer and brotli.Writer.
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// compress compresses responses with brotli or gzip, whichever the client
+// prefers in Accept-Encoding (brotli if both are equally acceptable).
+// Responses that handlers have already encoded are not compressed again.
+// Streamed responses are compressed, too, flushing flushes the encoder.
+func (app *application) compress(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+		if encoding == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressWriter{ResponseWriter: w, encoding: encoding, ifNoneMatch: r.Header.Get("If-None-Match")}
+		defer cw.Close()
+
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// negotiateEncoding returns the supported content coding with the highest
+// quality value in an Accept-Encoding header, or "" if the response must not
+// be compressed.
+func negotiateEncoding(header string) string {
+	qualities := map[string]float64{}
+	wildcard := -1.0
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+
+		q := 1.0
+		if name, value, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(name) == "q" {
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+
+		if coding == "*" {
+			wildcard = q
+		} else {
+			qualities[coding] = q
+		}
+	}
+
+	best, bestQ := "", 0.0
+	for _, coding := range []string{"br", "gzip"} {
+		q, ok := qualities[coding]
+		if !ok {
+			q = wildcard
+		}
+
+		if q > bestQ {
+			best, bestQ = coding, q
+		}
+	}
+
+	return best
+}
+
+// compressWriter decides whether to compress a response once its header is
+// written.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding    string
+	encoder     encoder // nil if the response is not compressed
+	wroteHeader bool
+
+	// Validators of the client, to answer with its tag in 304 responses
+	ifNoneMatch string
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.wroteHeader {
+		cw.ResponseWriter.WriteHeader(status)
+		return
+	}
+
+	cw.wroteHeader = true
+
+	if cw.compressible(status) {
+		h := cw.Header()
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", cw.encoding)
+		if etag := h.Get("ETag"); etag != "" {
+			h.Set("ETag", etagWithCoding(etag, cw.encoding))
+		}
+
+		cw.encoder = encoderPools[cw.encoding].Get().(encoder)
+		cw.encoder.Reset(cw.ResponseWriter)
+	}
+
+	// The client's copy has been compressed
+	if etag := cw.Header().Get("ETag"); status == http.StatusNotModified && etag != "" {
+		if coded := etagWithCoding(etag, cw.encoding); strings.Contains(cw.ifNoneMatch, coded) {
+			cw.Header().Set("ETag", coded)
+		}
+	}
+
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+// etagWithCoding derives the entity tag of a compressed response. Strong tags
+// must differ between content codings, so the coding is appended to them
+// (e.g. "3" becomes "3-gzip"). Weak tags are kept.
+func etagWithCoding(etag, coding string) string {
+	if strings.HasPrefix(etag, "W/") || !strings.HasSuffix(etag, `"`) {
+		return etag
+	}
+
+	return strings.TrimSuffix(etag, `"`) + "-" + coding + `"`
+}
+
+// etagWithoutCoding reverts etagWithCoding, so that preconditions accept the
+// tags of compressed responses.
+func etagWithoutCoding(etag string) string {
+	for coding := range encoderPools {
+		if suffix := "-" + coding + `"`; strings.HasSuffix(etag, suffix) {
+			return strings.TrimSuffix(etag, suffix) + `"`
+		}
+	}
+
+	return etag
+}
+
+func (cw *compressWriter) compressible(status int) bool {
+	h := cw.Header()
+	if status < http.StatusOK || status == http.StatusNoContent || status == http.StatusNotModified {
+		return false
+	}
+
+	if h.Get("Content-Encoding") != "" {
+		return false
+	}
+
+	if length, err := strconv.Atoi(h.Get("Content-Length")); err == nil && length < minCompressSize {
+		return false
+	}
+
+	mediaType, _, err := mime.ParseMediaType(h.Get("Content-Type"))
+	return err == nil && compressibleTypes[mediaType]
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+
+	if cw.encoder == nil {
+		return cw.ResponseWriter.Write(b)
+	}
+
+	return cw.encoder.Write(b)
+}
+
+func (cw *compressWriter) Flush() {
+	if cw.encoder != nil {
+		cw.encoder.Flush()
+	}
+
+	if flusher, ok := cw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Close writes the remaining compressed data and returns the encoder to its
+// pool.
+func (cw *compressWriter) Close() error {
+	if cw.encoder == nil {
+		return nil
+	}
+
+	err := cw.encoder.Close()
+	cw.encoder.Reset(io.Discard)
+	encoderPools[cw.encoding].Put(cw.encoder)
+	cw.encoder = nil
+
+	return err
+}
+
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
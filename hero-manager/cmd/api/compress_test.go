@@ -0,0 +1,128 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/stretchr/testify/assert"
+	"heroes.rainerstropek.com/internal/data"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := []struct {
+		header   string
+		encoding string
+	}{
+		{"", ""},
+		{"identity", ""},
+		{"gzip", "gzip"},
+		{"gzip, deflate, br", "br"},
+		{"br;q=0.5, gzip", "gzip"},
+		{"GZIP;q=0.8", "gzip"},
+		{"br;q=0, gzip;q=0", ""},
+		{"*", "br"},
+		{"*;q=0.1, br;q=0", "gzip"},
+		{"gzip;q=invalid", ""},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.encoding, negotiateEncoding(tt.header), tt.header)
+	}
+}
+
+func TestCompressResponses(t *testing.T) {
+	app, ts := newTestServer(t)
+	token := mintTestToken(t, "Heroes.Read")
+
+	var heroes []*data.Hero
+	for i := 0; i < 20; i++ {
+		heroes = append(heroes, &data.Hero{
+			Name:      fmt.Sprintf("Hero %d", i),
+			FirstSeen: time.Date(1938, 4, 18, 0, 0, 0, 0, time.UTC),
+			Abilities: []string{"super strong"},
+		})
+	}
+
+	err := app.models.Heroes.InsertMany(context.Background(), heroes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoders := map[string]func(io.Reader) (io.Reader, error){
+		"gzip": func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+		"br":   func(r io.Reader) (io.Reader, error) { return brotli.NewReader(r), nil },
+	}
+
+	for encoding, decode := range decoders {
+		rs := doRequest(t, ts, http.MethodGet, "/v1/heroes", token, "", "Accept-Encoding", encoding)
+		assert.Equal(t, http.StatusOK, rs.StatusCode)
+		assert.Equal(t, encoding, rs.Header.Get("Content-Encoding"))
+		assert.Contains(t, rs.Header.Values("Vary"), "Accept-Encoding")
+
+		body, err := decode(rs.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var list struct {
+			Heroes []json.RawMessage `json:"heroes"`
+		}
+		err = json.NewDecoder(body).Decode(&list)
+		assert.NoError(t, err, encoding)
+		assert.Len(t, list.Heroes, 20)
+	}
+
+	rs := doRequest(t, ts, http.MethodGet, "/v1/heroes", token, "", "Accept-Encoding", "identity")
+	assert.Empty(t, rs.Header.Get("Content-Encoding"))
+	assert.Contains(t, rs.Header.Values("Vary"), "Accept-Encoding")
+
+	// Small responses are not worth compressing
+	rs = doRequest(t, ts, http.MethodGet, "/v1/heroes/1", token, "", "Accept-Encoding", "gzip")
+	assert.Equal(t, http.StatusOK, rs.StatusCode)
+	assert.Empty(t, rs.Header.Get("Content-Encoding"))
+	assert.NotEmpty(t, rs.Header.Get("Content-Length"))
+}
+
+func TestCompressedETags(t *testing.T) {
+	_, ts := newTestServer(t)
+	token := mintTestToken(t, "Heroes.Read Heroes.Write")
+
+	// The real name makes the hero large enough to be compressed
+	hero := fmt.Sprintf(`{"name": "Superman", "realName": %q, "abilities": ["flight"]}`, strings.Repeat("Clark Kent ", 200))
+	rs := doRequest(t, ts, http.MethodPost, "/v1/heroes", token, hero, "Accept-Encoding", "identity")
+	assert.Equal(t, http.StatusCreated, rs.StatusCode)
+
+	for _, encoding := range []string{"gzip", "br"} {
+		etag := fmt.Sprintf(`"1-%s"`, encoding)
+
+		rs = doRequest(t, ts, http.MethodGet, "/v1/heroes/1", token, "", "Accept-Encoding", encoding)
+		assert.Equal(t, http.StatusOK, rs.StatusCode)
+		assert.Equal(t, encoding, rs.Header.Get("Content-Encoding"))
+		assert.Equal(t, etag, rs.Header.Get("ETag"))
+
+		rs = doRequest(t, ts, http.MethodGet, "/v1/heroes/1", token, "", "Accept-Encoding", encoding, "If-None-Match", etag)
+		assert.Equal(t, http.StatusNotModified, rs.StatusCode)
+		assert.Equal(t, etag, rs.Header.Get("ETag"))
+	}
+
+	// Uncompressed responses keep the tag of the version
+	rs = doRequest(t, ts, http.MethodGet, "/v1/heroes/1", token, "", "Accept-Encoding", "identity", "If-None-Match", `"1-gzip"`)
+	assert.Equal(t, http.StatusNotModified, rs.StatusCode)
+	assert.Equal(t, `"1"`, rs.Header.Get("ETag"))
+
+	// Tags of compressed responses can be used for updates
+	rs = doRequest(t, ts, http.MethodPatch, "/v1/heroes/1", token, `{"canFly": true}`, "Accept-Encoding", "identity", "If-Match", `"1-br"`)
+	assert.Equal(t, http.StatusOK, rs.StatusCode)
+	assert.Equal(t, `"2"`, rs.Header.Get("ETag"))
+
+	rs = doRequest(t, ts, http.MethodPatch, "/v1/heroes/1", token, `{"canFly": false}`, "If-Match", `"1-br"`)
+	assert.Equal(t, http.StatusPreconditionFailed, rs.StatusCode)
+}
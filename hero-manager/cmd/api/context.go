@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"net/http"
+)
+
+type contextKey string
+
+const (
+	requestInfoContextKey = contextKey("requestInfo")
+	requestIDContextKey   = contextKey("requestID")
+	apiVersionContextKey  = contextKey("apiVersion")
+)
+
+// requestInfo holds details of a request that are only known once inner
+// handlers have processed it, e.g. the route pattern matched by the router
+// or the subject of the validated JWT. Outer middlewares can read them after
+// the request has been handled.
+type requestInfo struct {
+	route   string
+	subject string
+}
+
+// contextWithRequestInfo adds an empty requestInfo to the request. If an
+// outer middleware has already added one, it is shared.
+func contextWithRequestInfo(r *http.Request) (*http.Request, *requestInfo) {
+	if info, ok := r.Context().Value(requestInfoContextKey).(*requestInfo); ok {
+		return r, info
+	}
+
+	info := &requestInfo{}
+	ctx := context.WithValue(r.Context(), requestInfoContextKey, info)
+	return r.WithContext(ctx), info
+}
+
+func setRoutePattern(r *http.Request, pattern string) {
+	if info, ok := r.Context().Value(requestInfoContextKey).(*requestInfo); ok {
+		info.route = pattern
+	}
+}
+
+func setSubject(r *http.Request, subject string) {
+	if info, ok := r.Context().Value(requestInfoContextKey).(*requestInfo); ok {
+		info.subject = subject
+	}
+}
+
+func contextWithRequestID(r *http.Request, id string) *http.Request {
+	ctx := context.WithValue(r.Context(), requestIDContextKey, id)
+	return r.WithContext(ctx)
+}
+
+// requestID returns the id identifying the request in error responses and
+// logs, or "" if the request has not passed logRequests.
+func requestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDContextKey).(string)
+	return id
+}
+
+func contextWithAPIVersion(r *http.Request, version apiVersion) *http.Request {
+	ctx := context.WithValue(r.Context(), apiVersionContextKey, version)
+	return r.WithContext(ctx)
+}
+
+// apiVersionOf returns the API version of the route serving the request.
+// Routes that only exist in /v1 do not set it.
+func apiVersionOf(r *http.Request) apiVersion {
+	if version, ok := r.Context().Value(apiVersionContextKey).(apiVersion); ok {
+		return version
+	}
+
+	return apiV1
+}
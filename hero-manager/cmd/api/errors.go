@@ -1,23 +1,77 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	jwtmiddleware "github.com/auth0/go-jwt-middleware/v2"
 )
 
+// problem is an RFC 7807 problem details object. All error responses are
+// rendered as one. Validation errors are reported per field in the errors
+// extension member. The request id is also logged with server errors, so
+// clients can refer to it when reporting problems.
+type problem struct {
+	Type      string            `json:"type"`
+	Title     string            `json:"title"`
+	Status    int               `json:"status"`
+	Detail    string            `json:"detail,omitempty"`
+	Instance  string            `json:"instance"`
+	Errors    map[string]string `json:"errors,omitempty"`
+	RequestID string            `json:"requestId,omitempty"`
+}
+
 func (app *application) logError(r *http.Request, err error) {
-	app.logger.Error().Err(err)
+	app.logger.Error().Err(err).
+		Str("request_id", requestID(r)).
+		Str("method", r.Method).
+		Str("url", r.URL.String()).
+		Msg("request failed")
 }
 
-func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, status int, message interface{}) {
-	err := app.writeJSON(w, status, message, nil)
+func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, status int, detail string) {
+	app.problemResponse(w, r, problem{Status: status, Detail: detail})
+}
+
+// problemResponse completes p with the members derived from the request and
+// writes it as application/problem+json. Problem types other than
+// about:blank are not used, the status code identifies the problem.
+func (app *application) problemResponse(w http.ResponseWriter, r *http.Request, p problem) {
+	p.Type = "about:blank"
+	p.Title = http.StatusText(p.Status)
+	p.Instance = r.URL.Path
+	p.RequestID = requestID(r)
+
+	js, err := json.Marshal(p)
 	if err != nil {
 		app.logError(r, err)
 		w.WriteHeader(500)
+		return
 	}
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(p.Status)
+	w.Write(js)
 }
 
 func (app *application) serverErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	// Cancelled and timed out database operations are no server errors
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		app.timeoutResponse(w, r, err)
+		return
+	case errors.Is(err, context.Canceled):
+		app.clientClosedRequest(r, err)
+		return
+	}
+
 	app.logError(r, err)
 
 	message := "the server encountered a problem and could not process your request"
@@ -38,6 +92,91 @@ func (app *application) badRequestResponse(w http.ResponseWriter, r *http.Reques
 	app.errorResponse(w, r, http.StatusBadRequest, err.Error())
 }
 
+func (app *application) unsupportedMediaTypeResponse(w http.ResponseWriter, r *http.Request, supported ...string) {
+	message := fmt.Sprintf("the content type must be one of %s", strings.Join(supported, ", "))
+	app.errorResponse(w, r, http.StatusUnsupportedMediaType, message)
+}
+
 func (app *application) failedValidationResponse(w http.ResponseWriter, r *http.Request, errors map[string]string) {
-	app.errorResponse(w, r, http.StatusUnprocessableEntity, errors)
+	app.problemResponse(w, r, problem{
+		Status: http.StatusUnprocessableEntity,
+		Detail: "the request contains invalid values, see errors for details",
+		Errors: errors,
+	})
+}
+
+func (app *application) editConflictResponse(w http.ResponseWriter, r *http.Request) {
+	message := "unable to update the record due to an edit conflict, please try again"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+func (app *application) idempotencyKeyReusedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the idempotency key has already been used for a different request"
+	app.errorResponse(w, r, http.StatusUnprocessableEntity, message)
+}
+
+func (app *application) idempotencyKeyInUseResponse(w http.ResponseWriter, r *http.Request) {
+	message := "a request with the same idempotency key is still being processed, please try again later"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+func (app *application) preconditionFailedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the record has been modified since it was read, please fetch the latest version"
+	app.errorResponse(w, r, http.StatusPreconditionFailed, message)
+}
+
+func (app *application) timeoutResponse(w http.ResponseWriter, r *http.Request, err error) {
+	app.logError(r, err)
+
+	message := "the database did not respond in time, please try again later"
+	app.errorResponse(w, r, http.StatusGatewayTimeout, message)
+}
+
+// clientClosedRequest handles requests aborted by the client. There is
+// nobody left to send a response to, so the request is only logged.
+func (app *application) clientClosedRequest(r *http.Request, err error) {
+	app.logger.Info().Err(err).Str("request_id", requestID(r)).Str("method", r.Method).Str("url", r.URL.String()).Msg("request cancelled by client")
+}
+
+// rateLimitExceededResponse tells the client to retry after retryAfter. The
+// Retry-After header is left out if retryAfter is not positive.
+func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	if retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	}
+
+	message := "rate limit exceeded"
+	app.errorResponse(w, r, http.StatusTooManyRequests, message)
+}
+
+func (app *application) invalidAuthenticationTokenResponse(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+
+	message := "invalid or missing authentication token"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+func (app *application) forbiddenResponse(w http.ResponseWriter, r *http.Request, permission string) {
+	message := fmt.Sprintf("your token does not grant the %s permission required to access this resource", permission)
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+
+func (app *application) jwtMissingResponse(w http.ResponseWriter, r *http.Request) {
+	app.invalidAuthenticationTokenResponse(w, r)
+}
+
+// jwtErrorHandler renders errors of the JWT middleware like all other errors.
+// Requests without a valid token are limited per IP address, they cannot be
+// limited per subject.
+func (app *application) jwtErrorHandler(w http.ResponseWriter, r *http.Request, err error) {
+	if !app.allowClientIP(w, r) {
+		return
+	}
+
+	switch {
+	case errors.Is(err, jwtmiddleware.ErrJWTMissing), errors.Is(err, jwtmiddleware.ErrJWTInvalid):
+		app.invalidAuthenticationTokenResponse(w, r)
+	default:
+		app.serverErrorResponse(w, r, err)
+	}
 }
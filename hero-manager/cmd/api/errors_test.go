@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func decodeProblem(t *testing.T, rs *http.Response) problem {
+	assert.Equal(t, "application/problem+json", rs.Header.Get("Content-Type"))
+
+	var p problem
+	err := json.NewDecoder(rs.Body).Decode(&p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return p
+}
+
+func TestErrorsAreProblemDetails(t *testing.T) {
+	_, ts := newTestServer(t)
+	token := mintTestToken(t, "Heroes.Read Heroes.Write")
+
+	rs := doRequest(t, ts, http.MethodGet, "/v1/heroes/42", token, "")
+	p := decodeProblem(t, rs)
+	assert.Equal(t, "about:blank", p.Type)
+	assert.Equal(t, "Not Found", p.Title)
+	assert.Equal(t, http.StatusNotFound, p.Status)
+	assert.Equal(t, "the requested resource could not be found", p.Detail)
+	assert.Equal(t, "/v1/heroes/42", p.Instance)
+	assert.Len(t, p.RequestID, 32)
+
+	rs = doRequest(t, ts, http.MethodPost, "/v1/heroes", token, `{"name": ""}`)
+	p = decodeProblem(t, rs)
+	assert.Equal(t, http.StatusUnprocessableEntity, p.Status)
+	assert.Equal(t, "must be provided", p.Errors["name"])
+
+	rs = doRequest(t, ts, http.MethodGet, "/v1/heroes", "", "")
+	p = decodeProblem(t, rs)
+	assert.Equal(t, http.StatusUnauthorized, p.Status)
+
+	second := decodeProblem(t, doRequest(t, ts, http.MethodGet, "/v1/heroes", "", ""))
+	assert.NotEqual(t, p.RequestID, second.RequestID)
+}
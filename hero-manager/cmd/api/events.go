@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"github.com/rs/zerolog"
+	"heroes.rainerstropek.com/internal/data"
+	"heroes.rainerstropek.com/internal/events"
+)
+
+// newEventPublisher returns the publisher of hero change events. Events are
+// posted to the configured webhook. Without a webhook, they are only logged.
+func newEventPublisher(cfg config, logger *zerolog.Logger) (events.EventPublisher, error) {
+	if cfg.events.webhookURL != "" {
+		if cfg.events.webhookSecret == "" {
+			return nil, errors.New("webhook requests cannot be signed without a secret")
+		}
+
+		return events.NewWebhookPublisher(cfg.events.webhookURL, []byte(cfg.events.webhookSecret)), nil
+	}
+
+	publisher := events.NewInProcessPublisher()
+	publisher.Subscribe(func(ctx context.Context, event *data.Event) error {
+		logger.Info().
+			Int64("event_id", event.ID).
+			Str("event_type", event.Type).
+			Int64("hero_id", event.HeroID).
+			Int32("version", event.Version).
+			Msg("hero event")
+		return nil
+	})
+
+	return publisher, nil
+}
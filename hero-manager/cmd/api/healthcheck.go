@@ -1,9 +1,18 @@
 package main
 
 import (
+	"context"
 	"net/http"
+	"time"
 )
 
+// Maximum time the database may take to answer the ping of a readiness check
+const readinessTimeout = time.Second
+
+// healthcheckHandler reports that the process is alive (liveness). It does
+// not check any dependencies, so a failing database never gets the process
+// restarted. It is served at /v1/healthz and, for existing clients, at
+// /v1/healthcheck.
 func (app *application) healthcheckHandler(w http.ResponseWriter, r *http.Request) {
 	data := map[string]string{
 		"status":      "available",
@@ -16,3 +25,64 @@ func (app *application) healthcheckHandler(w http.ResponseWriter, r *http.Reques
 		app.serverErrorResponse(w, r, err)
 	}
 }
+
+type readiness struct {
+	Status   string          `json:"status"`
+	Database *databaseHealth `json:"database,omitempty"`
+}
+
+type databaseHealth struct {
+	Status string    `json:"status"`
+	Pool   poolStats `json:"pool"`
+}
+
+type poolStats struct {
+	MaxOpen      int    `json:"maxOpen"`
+	Open         int    `json:"open"`
+	InUse        int    `json:"inUse"`
+	Idle         int    `json:"idle"`
+	WaitCount    int64  `json:"waitCount"`
+	WaitDuration string `json:"waitDuration"`
+}
+
+// readinessHandler reports whether the server can handle requests. It
+// responds with 503 if the database does not answer a ping in time or if the
+// server is shutting down, so that load balancers stop sending requests.
+// The in-memory driver has no database to check.
+func (app *application) readinessHandler(w http.ResponseWriter, r *http.Request) {
+	status := http.StatusOK
+	result := readiness{Status: "ready"}
+
+	if app.db != nil {
+		ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+		defer cancel()
+
+		result.Database = &databaseHealth{Status: "up"}
+		if err := app.db.PingContext(ctx); err != nil {
+			app.logger.Warn().Err(err).Str("request_id", requestID(r)).Msg("database ping failed")
+			result.Database.Status = "down"
+			result.Status = "unavailable"
+			status = http.StatusServiceUnavailable
+		}
+
+		stats := app.db.Stats()
+		result.Database.Pool = poolStats{
+			MaxOpen:      stats.MaxOpenConnections,
+			Open:         stats.OpenConnections,
+			InUse:        stats.InUse,
+			Idle:         stats.Idle,
+			WaitCount:    stats.WaitCount,
+			WaitDuration: stats.WaitDuration.String(),
+		}
+	}
+
+	if app.shuttingDown.Load() {
+		result.Status = "shutting down"
+		status = http.StatusServiceUnavailable
+	}
+
+	err := app.writeJSON(w, status, result, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -6,7 +6,9 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
+	"heroes.rainerstropek.com/internal/data"
 )
 
 func TestHealthcheck(t *testing.T) {
@@ -44,14 +46,16 @@ func TestHealthcheck(t *testing.T) {
 
 func TestHealthcheckEndToEnd(t *testing.T) {
 	// Setup mock configuration for "Test" environment
+	logger := zerolog.Nop()
 	app := &application{
 		config: config{
 			env: "Test",
 		},
+		logger: &logger,
 	}
 
 	// Run HTTPS server on random port
-	ts := httptest.NewTLSServer(app.routes())
+	ts := httptest.NewTLSServer(testRoutes(t, app))
 	defer ts.Close()
 
 	rs, err := ts.Client().Get(ts.URL + "/v1/healthcheck")
@@ -72,3 +76,91 @@ func TestHealthcheckEndToEnd(t *testing.T) {
 
 	assert.Equal(t, "Test", healthResult["environment"])
 }
+
+func TestReadiness(t *testing.T) {
+	db, err := openSQLite(config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := newTestApplication(data.NewMemoryHeroModel())
+	app.db = db
+	ts := httptest.NewServer(testRoutes(t, app))
+	defer ts.Close()
+
+	ready := func() (int, readiness) {
+		rs, err := ts.Client().Get(ts.URL + "/v1/readyz")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rs.Body.Close()
+
+		var result readiness
+		err = json.NewDecoder(rs.Body).Decode(&result)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return rs.StatusCode, result
+	}
+
+	status, result := ready()
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "ready", result.Status)
+	assert.Equal(t, "up", result.Database.Status)
+	assert.Equal(t, 1, result.Database.Pool.MaxOpen)
+
+	db.Close()
+	status, result = ready()
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, "down", result.Database.Status)
+
+	// Without a database, only shutdowns make the server unavailable
+	app.db = nil
+	status, result = ready()
+	assert.Equal(t, http.StatusOK, status)
+	assert.Nil(t, result.Database)
+
+	app.shuttingDown.Store(true)
+	status, result = ready()
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, "shutting down", result.Status)
+
+	// Liveness does not depend on readiness
+	rs, err := ts.Client().Get(ts.URL + "/v1/healthz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs.Body.Close()
+	assert.Equal(t, http.StatusOK, rs.StatusCode)
+}
+
+func TestProbesAreNotRateLimited(t *testing.T) {
+	app := newTestApplication(data.NewMemoryHeroModel())
+	app.config.limiter.enabled = true
+	app.config.limiter.rps = 1
+	app.config.limiter.burst = 1
+	ts := httptest.NewServer(testRoutes(t, app))
+	defer ts.Close()
+
+	for _, path := range []string{"/v1/healthz", "/v1/readyz"} {
+		for i := 0; i < 3; i++ {
+			rs, err := ts.Client().Get(ts.URL + path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rs.Body.Close()
+			assert.Equal(t, http.StatusOK, rs.StatusCode, path)
+		}
+	}
+
+	// Other anonymous routes are limited
+	for _, status := range []int{http.StatusOK, http.StatusTooManyRequests} {
+		rs, err := ts.Client().Get(ts.URL + "/v1/healthcheck")
+		if err != nil {
+			t.Fatal(err)
+		}
+		rs.Body.Close()
+		assert.Equal(t, status, rs.StatusCode)
+	}
+}
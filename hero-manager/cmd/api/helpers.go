@@ -1,6 +1,9 @@
 package main
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -9,37 +12,147 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
+	"heroes.rainerstropek.com/internal/data"
 	"heroes.rainerstropek.com/internal/validator"
 )
 
+type envelope map[string]interface{}
+
 func (app *application) readIDParam(r *http.Request) (int64, error) {
+	return app.readIDParamByName(r, "id")
+}
+
+// readIDParamByName reads an id from another route parameter than "id",
+// e.g. the hero in /v1/teams/:id/members/:heroId.
+func (app *application) readIDParamByName(r *http.Request, name string) (int64, error) {
 	params := httprouter.ParamsFromContext(r.Context())
 
-	id, err := strconv.ParseInt(params.ByName("id"), 10, 64)
+	id, err := strconv.ParseInt(params.ByName(name), 10, 64)
 	if err != nil || id < 1 {
-		return 0, errors.New("invalid id parameter")
+		return 0, fmt.Errorf("invalid %s parameter", name)
 	}
 
 	return id, nil
 }
 
+// newRequestID returns 16 random bytes in hex.
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// heroETag returns a strong entity tag derived from the hero's version.
+func (app *application) heroETag(hero *data.Hero) string {
+	return fmt.Sprintf(`"%d"`, hero.Version)
+}
+
+// teamETag returns a strong entity tag derived from the team's version.
+func (app *application) teamETag(team *data.Team) string {
+	return fmt.Sprintf(`"%d"`, team.Version)
+}
+
+// ifMatch checks the If-Match request header against the given entity tag.
+// A missing header or "*" always matches. Otherwise, one of the listed tags
+// must be equal to etag (strong comparison, weak tags never match). Tags of
+// compressed responses match the tag of the uncompressed one.
+func (app *application) ifMatch(r *http.Request, etag string) bool {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return true
+	}
+
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || etagWithoutCoding(tag) == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ifNoneMatch checks the If-None-Match request header against the given
+// entity tag. It reports whether the client already has the current
+// representation, i.e. whether one of the listed tags or "*" matches (weak
+// comparison, W/ prefixes and content codings are ignored). A missing header
+// never matches.
+func (app *application) ifNoneMatch(r *http.Request, etag string) bool {
+	header := r.Header.Get("If-None-Match")
+	if header == "" {
+		return false
+	}
+
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || etagWithoutCoding(strings.TrimPrefix(tag, "W/")) == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// notModifiedResponse tells the client that its copy is current. The
+// response has no body but carries the headers of a full response, e.g.
+// ETag.
+func (app *application) notModifiedResponse(w http.ResponseWriter, headers http.Header) {
+	for key, value := range headers {
+		w.Header()[key] = value
+	}
+
+	w.WriteHeader(http.StatusNotModified)
+}
+
 func (app *application) writeJSON(w http.ResponseWriter, status int, data interface{}, headers http.Header) error {
 	js, err := json.Marshal(data)
 	if err != nil {
 		return err
 	}
 
+	writeJSONBody(w, status, js, headers)
+	return nil
+}
+
+// writeListJSON writes a list with a weak entity tag derived from its JSON.
+// Lists have no version, so the tag changes whenever one of the listed
+// resources or the metadata changes. If the client's copy is current, only
+// 304 Not Modified is sent.
+func (app *application) writeListJSON(w http.ResponseWriter, r *http.Request, data interface{}, headers http.Header) error {
+	js, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	if headers == nil {
+		headers = make(http.Header)
+	}
+
+	sum := sha256.Sum256(js)
+	headers.Set("ETag", fmt.Sprintf(`W/"%s"`, hex.EncodeToString(sum[:16])))
+
+	if app.ifNoneMatch(r, headers.Get("ETag")) {
+		app.notModifiedResponse(w, headers)
+		return nil
+	}
+
+	writeJSONBody(w, http.StatusOK, js, headers)
+	return nil
+}
+
+func writeJSONBody(w http.ResponseWriter, status int, js []byte, headers http.Header) {
 	for key, value := range headers {
 		w.Header()[key] = value
 	}
 
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(len(js)))
 	w.WriteHeader(status)
 	w.Write(js)
-
-	return nil
 }
 
 func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst interface{}) error {
@@ -135,3 +248,79 @@ func (app *application) readInt(qs url.Values, key string, defaultValue int, v *
 
 	return i
 }
+
+func (app *application) readBool(qs url.Values, key string, defaultValue bool, v *validator.Validator) bool {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		v.AddError(key, "must be a boolean value")
+		return defaultValue
+	}
+
+	return b
+}
+
+// readTime reads an RFC 3339 timestamp or a date (e.g. 2006-01-02, midnight
+// UTC). dateOnly reports whether a date has been given.
+func (app *application) readTime(qs url.Values, key string, v *validator.Validator) (t time.Time, dateOnly bool) {
+	s := qs.Get(key)
+	if s == "" {
+		return time.Time{}, false
+	}
+
+	t, err := time.Parse(time.RFC3339, s)
+	if err == nil {
+		return t.UTC(), false
+	}
+
+	t, err = time.Parse(time.DateOnly, s)
+	if err == nil {
+		return t, true
+	}
+
+	v.AddError(key, "must be an RFC 3339 timestamp or a date (YYYY-MM-DD)")
+	return time.Time{}, false
+}
+
+// paginationLinks builds an RFC 8288 Link header value. In page mode, it
+// contains first, prev, next and last relations. In cursor mode, only a next
+// relation can be provided. All other query parameters of the request are preserved.
+func (app *application) paginationLinks(r *http.Request, metadata data.Metadata) string {
+	link := func(param, value, rel string) string {
+		u := *r.URL
+		qs := u.Query()
+		qs.Del("page")
+		qs.Del("cursor")
+		qs.Set(param, value)
+		u.RawQuery = qs.Encode()
+		return fmt.Sprintf(`<%s>; rel="%s"`, u.RequestURI(), rel)
+	}
+
+	if metadata.CurrentPage == 0 {
+		if metadata.NextCursor == "" {
+			return ""
+		}
+
+		return link("cursor", metadata.NextCursor, "next")
+	}
+
+	pageLink := func(page int, rel string) string {
+		return link("page", strconv.Itoa(page), rel)
+	}
+
+	links := []string{pageLink(metadata.FirstPage, "first")}
+	// Pages past the last one lead back to the last one
+	if metadata.CurrentPage > metadata.FirstPage {
+		links = append(links, pageLink(min(metadata.CurrentPage-1, metadata.LastPage), "prev"))
+	}
+	if metadata.CurrentPage < metadata.LastPage {
+		links = append(links, pageLink(metadata.CurrentPage+1, "next"))
+	}
+	links = append(links, pageLink(metadata.LastPage, "last"))
+
+	return strings.Join(links, ", ")
+}
@@ -4,23 +4,19 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"time"
 
 	"github.com/brianvoe/gofakeit/v6"
 	"heroes.rainerstropek.com/internal/data"
+	"heroes.rainerstropek.com/internal/middleware"
 	"heroes.rainerstropek.com/internal/validator"
 )
 
 func (app *application) createHeroHandler(w http.ResponseWriter, r *http.Request) {
-	var input struct {
-		Name      string    `json:"name"`
-		FirstSeen time.Time `json:"firstSeen"`
-		CanFly    bool      `json:"canFly"`
-		RealName  string    `json:"realName,omitempty"`
-		Abilities []string  `json:"abilities"`
-	}
+	var input heroInput
 
-	err := app.readJSON(w, r, &input)
+	err := app.readHeroJSON(w, r, &input)
 	if err != nil {
 		app.badRequestResponse(w, r, err)
 		return
@@ -41,16 +37,16 @@ func (app *application) createHeroHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	err = app.models.Heroes.Insert(hero)
+	err = app.models.Heroes.Insert(r.Context(), hero)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
 	headers := make(http.Header)
-	headers.Set("Location", fmt.Sprintf("/v1/movies/%d", hero.ID))
+	headers.Set("Location", heroLocation(r, hero))
 
-	err = app.writeJSON(w, http.StatusCreated, hero, headers)
+	err = app.writeJSON(w, http.StatusCreated, heroResponse(r, hero), headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -66,7 +62,7 @@ func (app *application) generateDemoDataHandler(w http.ResponseWriter, r *http.R
 			Abilities: []string{"foo", "bar"},
 		}
 
-		err := app.models.Heroes.Insert(hero)
+		err := app.models.Heroes.Insert(r.Context(), hero)
 		if err != nil {
 			app.serverErrorResponse(w, r, err)
 			return
@@ -83,11 +79,11 @@ func (app *application) generateDemoDataHandler(w http.ResponseWriter, r *http.R
 func (app *application) showHeroHandler(w http.ResponseWriter, r *http.Request) {
 	id, err := app.readIDParam(r)
 	if err != nil {
-		http.NotFound(w, r)
+		app.notFoundResponse(w, r)
 		return
 	}
 
-	hero, err := app.models.Heroes.Get(id)
+	hero, err := app.models.Heroes.Get(r.Context(), id)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -98,7 +94,15 @@ func (app *application) showHeroHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, hero, nil)
+	headers := make(http.Header)
+	headers.Set("ETag", app.heroETag(hero))
+
+	if app.ifNoneMatch(r, headers.Get("ETag")) {
+		app.notModifiedResponse(w, headers)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, heroResponse(r, hero), headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -111,7 +115,7 @@ func (app *application) updateHeroHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	hero, err := app.models.Heroes.Get(id)
+	hero, err := app.models.Heroes.Get(r.Context(), id)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -122,15 +126,14 @@ func (app *application) updateHeroHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	var input struct {
-		Name      string    `json:"name"`
-		FirstSeen time.Time `json:"firstSeen"`
-		CanFly    bool      `json:"canFly"`
-		RealName  string    `json:"realName,omitempty"`
-		Abilities []string  `json:"abilities"`
+	if !app.ifMatch(r, app.heroETag(hero)) {
+		app.preconditionFailedResponse(w, r)
+		return
 	}
 
-	err = app.readJSON(w, r, &input)
+	var input heroInput
+
+	err = app.readHeroJSON(w, r, &input)
 	if err != nil {
 		app.badRequestResponse(w, r, err)
 		return
@@ -149,13 +152,87 @@ func (app *application) updateHeroHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	err = app.models.Heroes.Update(hero)
+	err = app.models.Heroes.Update(r.Context(), hero)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", app.heroETag(hero))
+
+	err = app.writeJSON(w, http.StatusOK, heroResponse(r, hero), headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// patchHeroHandler applies a JSON merge patch (RFC 7396) to a hero. Fields
+// missing in the request body are left untouched.
+func (app *application) patchHeroHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	hero, err := app.models.Heroes.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !app.ifMatch(r, app.heroETag(hero)) {
+		app.preconditionFailedResponse(w, r)
+		return
+	}
+
+	var input heroPatch
+
+	err = app.readHeroJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, hero, nil)
+	err = input.apply(hero)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidateHero(v, hero); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Heroes.Update(r.Context(), hero)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", app.heroETag(hero))
+
+	err = app.writeJSON(w, http.StatusOK, heroResponse(r, hero), headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -168,7 +245,7 @@ func (app *application) deleteHeroHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	err = app.models.Heroes.Delete(id)
+	err = app.models.Heroes.Delete(r.Context(), id)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -185,35 +262,183 @@ func (app *application) deleteHeroHandler(w http.ResponseWriter, r *http.Request
 	}
 }
 
+// restoreHeroHandler undoes the deletion of a hero.
+func (app *application) restoreHeroHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	hero, err := app.models.Heroes.Restore(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", app.heroETag(hero))
+
+	err = app.writeJSON(w, http.StatusOK, heroResponse(r, hero), headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// purgeHeroHandler permanently deletes a hero, it cannot be restored afterwards.
+func (app *application) purgeHeroHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Heroes.Purge(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, "successfully purged", nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// heroSortSafelist contains the columns heroes can be sorted by.
+var heroSortSafelist = []string{"id", "name", "realname", "first_seen", "relevance"}
+
+// readHeroFilter reads the criteria heroes are listed and exported by.
+func (app *application) readHeroFilter(qs url.Values, v *validator.Validator) data.HeroFilter {
+	heroFilter := data.HeroFilter{
+		Name:           fmt.Sprintf("%%%s%%", app.readString(qs, "name", "")),
+		Abilities:      app.readCSV(qs, "abilities", []string{}),
+		Q:              app.readString(qs, "q", ""),
+		IncludeDeleted: app.readBool(qs, "include_deleted", false, v),
+	}
+
+	heroFilter.FirstSeenFrom, _ = app.readTime(qs, "first_seen_from", v)
+
+	// A date includes the whole day
+	to, dateOnly := app.readTime(qs, "first_seen_to", v)
+	if dateOnly {
+		to = to.AddDate(0, 0, 1).Add(-time.Microsecond)
+	}
+	heroFilter.FirstSeenTo = to
+
+	if qs.Get("can_fly") != "" {
+		canFly := app.readBool(qs, "can_fly", false, v)
+		heroFilter.CanFly = &canFly
+	}
+
+	return heroFilter
+}
+
+// defaultHeroSort returns the sort order of heroes if none is requested.
+// Search results are ranked by relevance.
+func defaultHeroSort(heroFilter data.HeroFilter) string {
+	if heroFilter.Q != "" {
+		return "relevance"
+	}
+
+	return "id"
+}
+
 func (app *application) listHeroesHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
-		Name      string
-		Abilities []string
+		data.HeroFilter
 		data.Filters
 	}
 
 	v := validator.New()
 	qs := r.URL.Query()
-	input.Name = app.readString(qs, "name", "")
-	input.Name = fmt.Sprintf("%%%s%%", input.Name)
-	input.Abilities = app.readCSV(qs, "abilities", []string{})
+	input.HeroFilter = app.readHeroFilter(qs, v)
 	input.Filters.Page = app.readInt(qs, "page", 1, v)
 	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
-	input.Filters.Sort = app.readString(qs, "sort", "id")
-	input.Filters.SortSafelist = []string{"id", "name", "realname"}
+	input.Filters.Cursor = app.readString(qs, "cursor", "")
+	input.Filters.Sort = app.readString(qs, "sort", defaultHeroSort(input.HeroFilter))
+	input.Filters.SortSafelist = heroSortSafelist
 
+	data.ValidateHeroFilter(v, input.HeroFilter, input.Filters)
 	if data.ValidateFilters(v, input.Filters); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	heroes, err := app.models.Heroes.GetAll(input.Name, input.Abilities, input.Filters)
+	// Only admins can see deleted heroes
+	if input.IncludeDeleted && !middleware.HasPermission(r, middleware.PermissionAdmin) {
+		app.forbiddenResponse(w, r, middleware.PermissionAdmin)
+		return
+	}
+
+	heroes, metadata, err := app.models.Heroes.GetAll(r.Context(), input.HeroFilter, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	if links := app.paginationLinks(r, metadata); links != "" {
+		headers.Set("Link", links)
+	}
+
+	err = app.writeListJSON(w, r, envelope{"metadata": metadata, "heroes": heroesResponse(r, heroes)}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// heroHistoryHandler lists the audit events of a hero, newest first by default.
+// The history of deleted heroes is still available.
+func (app *application) heroHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var filters data.Filters
+
+	v := validator.New()
+	qs := r.URL.Query()
+	filters.Page = app.readInt(qs, "page", 1, v)
+	filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	filters.Sort = app.readString(qs, "sort", "-id")
+	filters.SortSafelist = []string{"id"}
+
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	events, metadata, err := app.models.Heroes.History(r.Context(), id, filters)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, heroes, nil)
+	// Every hero has at least the event of its creation
+	if len(events) == 0 && filters.Page == 1 {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	headers := make(http.Header)
+	if links := app.paginationLinks(r, metadata); links != "" {
+		headers.Set("Link", links)
+	}
+
+	err = app.writeListJSON(w, r, envelope{"metadata": metadata, "events": events}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"heroes.rainerstropek.com/internal/data"
+	"heroes.rainerstropek.com/mocks"
+)
+
+func newTestApplication(heroes data.HeroesRepository) *application {
+	logger := zerolog.Nop()
+	return &application{
+		config: config{env: "Test"},
+		logger: &logger,
+		models: data.Models{Heroes: heroes},
+	}
+}
+
+func newHeroRequest(method, id, body string) *http.Request {
+	r := httptest.NewRequest(method, "/v1/heroes/"+id, strings.NewReader(body))
+	ctx := context.WithValue(r.Context(), httprouter.ParamsKey, httprouter.Params{{Key: "id", Value: id}})
+	return r.WithContext(ctx)
+}
+
+func newTestHero() *data.Hero {
+	return &data.Hero{
+		ID:        1,
+		FirstSeen: time.Date(1938, 4, 18, 0, 0, 0, 0, time.UTC),
+		Name:      "Superman",
+		CanFly:    true,
+		RealName:  "Clark Kent",
+		Abilities: []string{"super strong"},
+		Version:   2,
+	}
+}
+
+func TestPatchHeroMergesFields(t *testing.T) {
+	repo := &mocks.HeroesRepository{}
+	repo.On("Get", mock.Anything, int64(1)).Return(newTestHero(), nil)
+	repo.On("Update", mock.Anything, mock.AnythingOfType("*data.Hero")).Run(func(args mock.Arguments) {
+		args.Get(1).(*data.Hero).Version++
+	}).Return(nil)
+	app := newTestApplication(repo)
+
+	rr := httptest.NewRecorder()
+	r := newHeroRequest(http.MethodPatch, "1", `{"realName": "Kal-El"}`)
+	r.Header.Set("If-Match", `"2"`)
+	app.patchHeroHandler(rr, r)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, `"3"`, rr.Header().Get("ETag"))
+
+	var result map[string]interface{}
+	err := json.NewDecoder(rr.Body).Decode(&result)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "Superman", result["name"])
+	assert.Equal(t, "Kal-El", result["realName"])
+	assert.Equal(t, true, result["canFly"])
+}
+
+func TestPatchHeroNullRemovesRealName(t *testing.T) {
+	for body, realName := range map[string]string{
+		`{"realName": null}`:   "",
+		`{"canFly": false}`:    "Clark Kent",
+		`{"realName": "Kent"}`: "Kent",
+	} {
+		t.Run(body, func(t *testing.T) {
+			repo := &mocks.HeroesRepository{}
+			repo.On("Get", mock.Anything, int64(1)).Return(newTestHero(), nil)
+			repo.On("Update", mock.Anything, mock.AnythingOfType("*data.Hero")).Return(nil)
+			app := newTestApplication(repo)
+
+			rr := httptest.NewRecorder()
+			app.patchHeroHandler(rr, newHeroRequest(http.MethodPatch, "1", body))
+
+			assert.Equal(t, http.StatusOK, rr.Code)
+			repo.AssertCalled(t, "Update", mock.Anything, mock.MatchedBy(func(hero *data.Hero) bool {
+				return hero.RealName == realName
+			}))
+		})
+	}
+
+	repo := &mocks.HeroesRepository{}
+	repo.On("Get", mock.Anything, int64(1)).Return(newTestHero(), nil)
+	app := newTestApplication(repo)
+
+	rr := httptest.NewRecorder()
+	app.patchHeroHandler(rr, newHeroRequest(http.MethodPatch, "1", `{"realName": 42}`))
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), `incorrect JSON type for field \"realName\"`)
+	repo.AssertNotCalled(t, "Update", mock.Anything, mock.Anything)
+}
+
+func TestPatchHeroNullRemovesRequiredFields(t *testing.T) {
+	for body, field := range map[string]string{
+		`{"name": null}`:      "name",
+		`{"abilities": null}`: "abilities",
+	} {
+		t.Run(body, func(t *testing.T) {
+			repo := &mocks.HeroesRepository{}
+			repo.On("Get", mock.Anything, int64(1)).Return(newTestHero(), nil)
+			app := newTestApplication(repo)
+
+			rr := httptest.NewRecorder()
+			app.patchHeroHandler(rr, newHeroRequest(http.MethodPatch, "1", body))
+
+			assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+			assert.Contains(t, rr.Body.String(), fmt.Sprintf(`"%s":"must be provided"`, field))
+			repo.AssertNotCalled(t, "Update", mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestPatchHeroStaleIfMatch(t *testing.T) {
+	repo := &mocks.HeroesRepository{}
+	repo.On("Get", mock.Anything, int64(1)).Return(newTestHero(), nil)
+	app := newTestApplication(repo)
+
+	rr := httptest.NewRecorder()
+	r := newHeroRequest(http.MethodPatch, "1", `{"name": "Homelander"}`)
+	r.Header.Set("If-Match", `"1"`)
+	app.patchHeroHandler(rr, r)
+
+	assert.Equal(t, http.StatusPreconditionFailed, rr.Code)
+	repo.AssertNotCalled(t, "Update", mock.Anything, mock.Anything)
+}
+
+func TestPatchHeroEditConflict(t *testing.T) {
+	repo := &mocks.HeroesRepository{}
+	repo.On("Get", mock.Anything, int64(1)).Return(newTestHero(), nil)
+	repo.On("Update", mock.Anything, mock.AnythingOfType("*data.Hero")).Return(data.ErrEditConflict)
+	app := newTestApplication(repo)
+
+	rr := httptest.NewRecorder()
+	r := newHeroRequest(http.MethodPatch, "1", `{"canFly": false}`)
+	app.patchHeroHandler(rr, r)
+
+	assert.Equal(t, http.StatusConflict, rr.Code)
+}
+
+func TestListHeroesPaginationEnvelope(t *testing.T) {
+	repo := &mocks.HeroesRepository{}
+	metadata := data.Metadata{CurrentPage: 2, PageSize: 3, FirstPage: 1, LastPage: 4, TotalRecords: 10}
+	repo.On("GetAll", mock.Anything, data.HeroFilter{Name: "%%", Abilities: []string{}}, mock.AnythingOfType("data.Filters")).Return([]*data.Hero{newTestHero()}, metadata, nil)
+	app := newTestApplication(repo)
+
+	rr := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/v1/heroes?page=2&page_size=3", nil)
+	app.listHeroesHandler(rr, r)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	links := rr.Header().Get("Link")
+	assert.Contains(t, links, `</v1/heroes?page=1&page_size=3>; rel="first"`)
+	assert.Contains(t, links, `</v1/heroes?page=1&page_size=3>; rel="prev"`)
+	assert.Contains(t, links, `</v1/heroes?page=3&page_size=3>; rel="next"`)
+	assert.Contains(t, links, `</v1/heroes?page=4&page_size=3>; rel="last"`)
+
+	var result struct {
+		Metadata data.Metadata            `json:"metadata"`
+		Heroes   []map[string]interface{} `json:"heroes"`
+	}
+	err := json.NewDecoder(rr.Body).Decode(&result)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, metadata, result.Metadata)
+	assert.Len(t, result.Heroes, 1)
+}
+
+func TestShowHeroQueryTimeout(t *testing.T) {
+	repo := &mocks.HeroesRepository{}
+	repo.On("Get", mock.Anything, int64(1)).Return(nil, fmt.Errorf("%w: query cancelled", context.DeadlineExceeded))
+	app := newTestApplication(repo)
+
+	rr := httptest.NewRecorder()
+	app.showHeroHandler(rr, newHeroRequest(http.MethodGet, "1", ""))
+
+	assert.Equal(t, http.StatusGatewayTimeout, rr.Code)
+}
+
+func TestListHeroesSearchSortsByRelevance(t *testing.T) {
+	repo := &mocks.HeroesRepository{}
+	heroFilter := data.HeroFilter{Name: "%%", Abilities: []string{}, Q: "clark kent"}
+	relevance := mock.MatchedBy(func(f data.Filters) bool { return f.Sort == "relevance" })
+	repo.On("GetAll", mock.Anything, heroFilter, relevance).Return([]*data.Hero{newTestHero()}, data.Metadata{}, nil)
+	app := newTestApplication(repo)
+
+	rr := httptest.NewRecorder()
+	app.listHeroesHandler(rr, httptest.NewRequest(http.MethodGet, "/v1/heroes?q=clark+kent", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	rr = httptest.NewRecorder()
+	app.listHeroesHandler(rr, httptest.NewRequest(http.MethodGet, "/v1/heroes?sort=relevance", nil))
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+}
+
+func TestListHeroesFirstSeenAndCanFlyFilters(t *testing.T) {
+	repo := &mocks.HeroesRepository{}
+	canFly := false
+	heroFilter := data.HeroFilter{
+		Name:          "%%",
+		Abilities:     []string{},
+		FirstSeenFrom: time.Date(1938, 4, 18, 12, 0, 0, 0, time.UTC),
+		FirstSeenTo:   time.Date(1941, 10, 1, 23, 59, 59, 999999000, time.UTC),
+		CanFly:        &canFly,
+	}
+	repo.On("GetAll", mock.Anything, heroFilter, mock.AnythingOfType("data.Filters")).Return([]*data.Hero{}, data.Metadata{}, nil)
+	app := newTestApplication(repo)
+
+	rr := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/v1/heroes?first_seen_from=1938-04-18T14:00:00%2B02:00&first_seen_to=1941-10-01&can_fly=false&sort=first_seen", nil)
+	app.listHeroesHandler(rr, r)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	rr = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodGet, "/v1/heroes?first_seen_from=1941-10-02&first_seen_to=1941-10-01&can_fly=maybe", nil)
+	app.listHeroesHandler(rr, r)
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+
+	var result problem
+	err := json.NewDecoder(rr.Body).Decode(&result)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Contains(t, result.Errors, "first_seen_to")
+	assert.Contains(t, result.Errors, "can_fly")
+}
+
+func TestConditionalGet(t *testing.T) {
+	_, ts := newTestServer(t)
+	token := mintTestToken(t, "Heroes.Read Heroes.Write")
+
+	rs := doRequest(t, ts, http.MethodPost, "/v1/heroes", token,
+		`{"name": "Superman", "firstSeen": "1938-04-18T00:00:00Z", "abilities": ["flight"]}`)
+	assert.Equal(t, http.StatusCreated, rs.StatusCode)
+
+	// Heroes have a strong entity tag derived from their version
+	rs = doRequest(t, ts, http.MethodGet, "/v1/heroes/1", token, "", "If-None-Match", `"1"`)
+	assert.Equal(t, http.StatusNotModified, rs.StatusCode)
+	assert.Equal(t, `"1"`, rs.Header.Get("ETag"))
+
+	body, err := io.ReadAll(rs.Body)
+	assert.NoError(t, err)
+	assert.Empty(t, body)
+
+	rs = doRequest(t, ts, http.MethodGet, "/v1/heroes/1", token, "", "If-None-Match", `W/"0", W/"1"`)
+	assert.Equal(t, http.StatusNotModified, rs.StatusCode)
+
+	rs = doRequest(t, ts, http.MethodGet, "/v1/heroes/1", token, "", "If-None-Match", `"0"`)
+	assert.Equal(t, http.StatusOK, rs.StatusCode)
+
+	// Lists have a weak entity tag derived from their content
+	rs = doRequest(t, ts, http.MethodGet, "/v1/heroes", token, "")
+	assert.Equal(t, http.StatusOK, rs.StatusCode)
+
+	etag := rs.Header.Get("ETag")
+	assert.True(t, strings.HasPrefix(etag, `W/"`), etag)
+
+	rs = doRequest(t, ts, http.MethodGet, "/v1/heroes", token, "", "If-None-Match", etag)
+	assert.Equal(t, http.StatusNotModified, rs.StatusCode)
+	assert.Equal(t, etag, rs.Header.Get("ETag"))
+	assert.NotEmpty(t, rs.Header.Get("Link"))
+
+	// Other representations have other tags
+	rs = doRequest(t, ts, http.MethodGet, "/v2/heroes", token, "", "If-None-Match", etag)
+	assert.Equal(t, http.StatusOK, rs.StatusCode)
+
+	rs = doRequest(t, ts, http.MethodPatch, "/v1/heroes/1", token, `{"canFly": true}`)
+	assert.Equal(t, http.StatusOK, rs.StatusCode)
+
+	rs = doRequest(t, ts, http.MethodGet, "/v1/heroes", token, "", "If-None-Match", etag)
+	assert.Equal(t, http.StatusOK, rs.StatusCode)
+	assert.NotEqual(t, etag, rs.Header.Get("ETag"))
+
+	rs = doRequest(t, ts, http.MethodGet, "/v1/heroes/1", token, "", "If-None-Match", `"1"`)
+	assert.Equal(t, http.StatusOK, rs.StatusCode)
+	assert.Equal(t, `"2"`, rs.Header.Get("ETag"))
+}
+
+func TestListHeroesPastLastPage(t *testing.T) {
+	_, ts := newTestServer(t)
+	token := mintTestToken(t, "Heroes.Read Heroes.Write")
+
+	for _, name := range []string{"Superman", "Batman"} {
+		rs := doRequest(t, ts, http.MethodPost, "/v1/heroes", token, fmt.Sprintf(`{"name": %q, "abilities": ["flight"]}`, name))
+		assert.Equal(t, http.StatusCreated, rs.StatusCode)
+	}
+
+	rs := doRequest(t, ts, http.MethodGet, "/v1/heroes?page=5&page_size=1", token, "")
+	assert.Equal(t, http.StatusOK, rs.StatusCode)
+	assert.Equal(t, `</v1/heroes?page=1&page_size=1>; rel="first", </v1/heroes?page=2&page_size=1>; rel="prev", </v1/heroes?page=2&page_size=1>; rel="last"`, rs.Header.Get("Link"))
+}
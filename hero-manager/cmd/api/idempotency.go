@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"heroes.rainerstropek.com/internal/data"
+	"heroes.rainerstropek.com/internal/middleware"
+)
+
+const (
+	maxIdempotencyKeyLength = 255
+
+	// Time a key stays reserved for a request that is being processed. If the
+	// process crashes before storing the response, the key can be reused
+	// afterwards.
+	idempotencyReservation = time.Minute
+)
+
+// codingHeaders depend on the content coding negotiated by compress, which is
+// negotiated again when a response is replayed. They are not stored, the
+// stored body is never compressed.
+var codingHeaders = map[string]bool{
+	"Content-Encoding": true,
+	"Content-Length":   true,
+	"Vary":             true,
+}
+
+// idempotent makes a handler safe to retry if the client sends an
+// Idempotency-Key header. The first response for a key is stored per
+// authenticated subject and replayed for repeated requests until it expires
+// after the configured TTL. Replayed responses carry Idempotent-Replayed.
+// Reusing a key for a different request fails with 422, repeating a request
+// that is still being processed with 409. Server errors are not stored, so
+// such requests can be retried with the same key. Requests without the
+// header are passed on unchanged. It must be used behind the JWT middleware.
+func (app *application) idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		subject, ok := middleware.Subject(r)
+		if key == "" || !ok {
+			next(w, r)
+			return
+		}
+
+		if len(key) > maxIdempotencyKeyLength {
+			app.failedValidationResponse(w, r, map[string]string{
+				"Idempotency-Key": fmt.Sprintf("must not be more than %d bytes long", maxIdempotencyKeyLength),
+			})
+			return
+		}
+
+		maxBytes := 1_048_576
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, int64(maxBytes)))
+		if err != nil {
+			var maxBytesError *http.MaxBytesError
+			if errors.As(err, &maxBytesError) {
+				app.badRequestResponse(w, r, fmt.Errorf("body must not be larger than %d bytes", maxBytes))
+				return
+			}
+
+			app.badRequestResponse(w, r, err)
+			return
+		}
+
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		record := &data.IdempotencyRecord{
+			Subject:     subject,
+			Key:         key,
+			Fingerprint: requestFingerprint(r, body),
+			ExpiresAt:   time.Now().Add(idempotencyReservation),
+		}
+
+		existing, err := app.models.Idempotency.Reserve(r.Context(), record)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		if existing != nil {
+			switch {
+			case existing.Fingerprint != record.Fingerprint:
+				app.idempotencyKeyReusedResponse(w, r)
+			case !existing.Completed():
+				app.idempotencyKeyInUseResponse(w, r)
+			default:
+				replayResponse(w, existing)
+			}
+
+			return
+		}
+
+		// Only headers set by next are stored, not those of outer middlewares
+		// (e.g. X-Request-ID)
+		before := w.Header().Clone()
+		rec := &responseCapture{statusRecorder: newStatusRecorder(w)}
+		completed := false
+
+		// The response has been sent at this point, the outcome is stored even
+		// if the client has gone away
+		ctx := context.WithoutCancel(r.Context())
+		defer func() {
+			if completed {
+				return
+			}
+
+			if err := app.models.Idempotency.Release(ctx, subject, key); err != nil {
+				app.logError(r, err)
+			}
+		}()
+
+		next(rec, r)
+
+		if rec.status >= http.StatusInternalServerError || r.Context().Err() != nil {
+			return
+		}
+
+		record.Status = rec.status
+		record.Header = make(map[string][]string)
+		for name, values := range w.Header() {
+			if codingHeaders[name] || slices.Equal(before[name], values) {
+				continue
+			}
+
+			if name == "Etag" {
+				values = []string{etagWithoutCoding(w.Header().Get("ETag"))}
+			}
+			record.Header[name] = values
+		}
+		record.Body = rec.body.Bytes()
+		record.ExpiresAt = time.Now().Add(app.config.idempotency.ttl)
+
+		err = app.models.Idempotency.Complete(ctx, record)
+		if err != nil {
+			app.logError(r, err)
+			return
+		}
+
+		completed = true
+	}
+}
+
+// requestFingerprint identifies the request that an idempotency key has been
+// used for. The path contains the API version, so a key cannot be reused
+// across versions either.
+func requestFingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s %s\n", r.Method, r.URL.Path)
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// replayResponse writes a stored response.
+func replayResponse(w http.ResponseWriter, record *data.IdempotencyRecord) {
+	for name, values := range record.Header {
+		w.Header()[name] = values
+	}
+
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.Header().Set("Content-Length", strconv.Itoa(len(record.Body)))
+	w.WriteHeader(record.Status)
+	w.Write(record.Body)
+}
+
+// responseCapture records the body of a response in addition to its status.
+type responseCapture struct {
+	*statusRecorder
+	body bytes.Buffer
+}
+
+func (c *responseCapture) Write(b []byte) (int, error) {
+	n, err := c.statusRecorder.Write(b)
+	c.body.Write(b[:n])
+	return n, err
+}
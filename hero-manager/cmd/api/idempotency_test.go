@@ -0,0 +1,156 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"heroes.rainerstropek.com/internal/data"
+	"heroes.rainerstropek.com/internal/jwttest"
+	"heroes.rainerstropek.com/internal/middleware"
+)
+
+func TestIdempotentCreateHero(t *testing.T) {
+	app, ts := newTestServer(t)
+	app.config.idempotency.ttl = time.Hour
+	token := mintTestToken(t, "Heroes.Read Heroes.Write")
+
+	superman := `{"name": "Superman", "firstSeen": "1938-04-18T00:00:00Z", "canFly": true, "abilities": ["flight"]}`
+	batman := `{"name": "Batman", "firstSeen": "1939-05-01T00:00:00Z", "abilities": ["detective"]}`
+
+	rs := doRequest(t, ts, http.MethodPost, "/v1/heroes", token, superman, "Idempotency-Key", "key-1")
+	assert.Equal(t, http.StatusCreated, rs.StatusCode)
+	assert.Empty(t, rs.Header.Get("Idempotent-Replayed"))
+
+	created, err := io.ReadAll(rs.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Retries get the first response instead of creating another hero
+	rs = doRequest(t, ts, http.MethodPost, "/v1/heroes", token, superman, "Idempotency-Key", "key-1")
+	assert.Equal(t, http.StatusCreated, rs.StatusCode)
+	assert.Equal(t, "true", rs.Header.Get("Idempotent-Replayed"))
+	assert.Equal(t, "/v1/heroes/1", rs.Header.Get("Location"))
+	assert.Equal(t, "application/json", rs.Header.Get("Content-Type"))
+	assert.NotEmpty(t, rs.Header.Get("X-Request-ID"))
+
+	replayed, err := io.ReadAll(rs.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, string(created), string(replayed))
+
+	_, metadata, err := app.models.Heroes.GetAll(context.Background(), data.HeroFilter{}, data.Filters{Page: 1, PageSize: 10, Sort: "id", SortSafelist: []string{"id"}})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, metadata.TotalRecords)
+
+	// Keys cannot be reused for other requests
+	rs = doRequest(t, ts, http.MethodPost, "/v1/heroes", token, batman, "Idempotency-Key", "key-1")
+	assert.Equal(t, http.StatusUnprocessableEntity, rs.StatusCode)
+
+	rs = doRequest(t, ts, http.MethodPost, "/v2/heroes", token, superman, "Idempotency-Key", "key-1")
+	assert.Equal(t, http.StatusUnprocessableEntity, rs.StatusCode)
+
+	// Keys are scoped to the subject
+	other, err := jwttest.Mint("other-user", middleware.CustomClaimsExample{Scope: "Heroes.Write"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rs = doRequest(t, ts, http.MethodPost, "/v1/heroes", other, batman, "Idempotency-Key", "key-1")
+	assert.Equal(t, http.StatusCreated, rs.StatusCode)
+	assert.Equal(t, "/v1/heroes/2", rs.Header.Get("Location"))
+
+	// Requests without key are not deduplicated
+	for _, location := range []string{"/v1/heroes/3", "/v1/heroes/4"} {
+		rs = doRequest(t, ts, http.MethodPost, "/v1/heroes", token, batman)
+		assert.Equal(t, http.StatusCreated, rs.StatusCode)
+		assert.Equal(t, location, rs.Header.Get("Location"))
+	}
+
+	// Validation errors are replayed, too
+	for _, replayed := range []string{"", "true"} {
+		rs = doRequest(t, ts, http.MethodPost, "/v1/heroes", token, `{"name": ""}`, "Idempotency-Key", "key-2")
+		assert.Equal(t, http.StatusUnprocessableEntity, rs.StatusCode)
+		assert.Equal(t, replayed, rs.Header.Get("Idempotent-Replayed"))
+	}
+
+	rs = doRequest(t, ts, http.MethodPost, "/v1/heroes", token, superman, "Idempotency-Key", strings.Repeat("k", 256))
+	assert.Equal(t, http.StatusUnprocessableEntity, rs.StatusCode)
+}
+
+func TestIdempotencyKeyInUse(t *testing.T) {
+	app, ts := newTestServer(t)
+	app.config.idempotency.ttl = time.Hour
+	token := mintTestToken(t, "Heroes.Write")
+
+	body := `{"name": "Superman", "firstSeen": "1938-04-18T00:00:00Z", "abilities": ["flight"]}`
+	r, err := http.NewRequest(http.MethodPost, "/v1/heroes", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate a request that is still being processed
+	existing, err := app.models.Idempotency.Reserve(context.Background(), &data.IdempotencyRecord{
+		Subject:     "test-user",
+		Key:         "key-1",
+		Fingerprint: requestFingerprint(r, []byte(body)),
+		ExpiresAt:   time.Now().Add(time.Minute),
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, existing)
+
+	rs := doRequest(t, ts, http.MethodPost, "/v1/heroes", token, body, "Idempotency-Key", "key-1")
+	assert.Equal(t, http.StatusConflict, rs.StatusCode)
+
+	assert.NoError(t, app.models.Idempotency.Release(context.Background(), "test-user", "key-1"))
+
+	rs = doRequest(t, ts, http.MethodPost, "/v1/heroes", token, body, "Idempotency-Key", "key-1")
+	assert.Equal(t, http.StatusCreated, rs.StatusCode)
+}
+
+func TestIdempotentReplayIsCompressedAgain(t *testing.T) {
+	app, ts := newTestServer(t)
+	app.config.idempotency.ttl = time.Hour
+	token := mintTestToken(t, "Heroes.Write")
+
+	// The real name makes the response large enough to be compressed
+	hero := fmt.Sprintf(`{"name": "Superman", "realName": %q, "abilities": ["flight"]}`, strings.Repeat("Clark Kent ", 200))
+
+	var created string
+	for _, replayed := range []string{"", "true"} {
+		rs := doRequest(t, ts, http.MethodPost, "/v1/heroes", token, hero, "Idempotency-Key", "key-1", "Accept-Encoding", "gzip")
+		assert.Equal(t, http.StatusCreated, rs.StatusCode)
+		assert.Equal(t, replayed, rs.Header.Get("Idempotent-Replayed"))
+		assert.Equal(t, "gzip", rs.Header.Get("Content-Encoding"))
+
+		body, err := gzip.NewReader(rs.Body)
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		decoded, err := io.ReadAll(body)
+		assert.NoError(t, err)
+		if created == "" {
+			created = string(decoded)
+		}
+		assert.Equal(t, created, string(decoded))
+	}
+
+	rs := doRequest(t, ts, http.MethodPost, "/v1/heroes", token, hero, "Idempotency-Key", "key-1", "Accept-Encoding", "identity")
+	assert.Equal(t, http.StatusCreated, rs.StatusCode)
+	assert.Equal(t, "true", rs.Header.Get("Idempotent-Replayed"))
+	assert.Empty(t, rs.Header.Get("Content-Encoding"))
+
+	replayed, err := io.ReadAll(rs.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, created, string(replayed))
+}
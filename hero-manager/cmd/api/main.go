@@ -3,36 +3,69 @@ package main
 import (
 	"context"
 	"database/sql"
+	"fmt"
 
 	"flag"
 	"os"
+	"strings"
+	"sync/atomic"
 	"time"
 
+	jwtmiddleware "github.com/auth0/go-jwt-middleware/v2"
 	_ "github.com/lib/pq"
 	"github.com/rs/zerolog"
 	"heroes.rainerstropek.com/internal/data"
+	"heroes.rainerstropek.com/internal/events"
+	"heroes.rainerstropek.com/internal/middleware"
+	"heroes.rainerstropek.com/internal/migrate"
+	"heroes.rainerstropek.com/migrations"
+	_ "modernc.org/sqlite"
 )
 
 const version = "1.0.0"
 
 type config struct {
-	port int
-	env  string
-	db   struct {
+	port          int
+	env           string
+	shutdownDelay time.Duration
+	db            struct {
+		driver       string
 		dsn          string
 		maxOpenConns int
 		maxIdleConns int
 		maxIdleTime  string
+		queryTimeout time.Duration
+		migrate      string
 	}
 	azure struct {
 		tenantId string
 	}
+	jwt     middleware.JwtConfig
+	limiter struct {
+		rps     float64
+		burst   int
+		enabled bool
+	}
+	events struct {
+		webhookURL    string
+		webhookSecret string
+	}
+	idempotency struct {
+		ttl time.Duration
+	}
 }
 
 type application struct {
-	config config
-	logger *zerolog.Logger
-	models data.Models
+	config       config
+	logger       *zerolog.Logger
+	db           *sql.DB // nil for the in-memory driver
+	models       data.Models
+	jwt          *jwtmiddleware.JWTMiddleware
+	publisher    events.EventPublisher
+	shuttingDown atomic.Bool  // fails readiness checks once set
+	registered   []route      // routes registered by routes()
+	limiter      *rateLimiter // clients of the rate limit, created by routes()
+	openAPI      []byte       // OpenAPI document of the registered routes
 }
 
 func main() {
@@ -40,28 +73,99 @@ func main() {
 
 	flag.IntVar(&cfg.port, "port", 4000, "API server port")
 	flag.StringVar(&cfg.env, "env", "development", "Environment (development|staging|production)")
-	flag.StringVar(&cfg.db.dsn, "db-dsn", os.Getenv("HEROES_DB_DSN"), "PostgreSQL DSN")
+	flag.DurationVar(&cfg.shutdownDelay, "shutdown-delay", 5*time.Second, "Time between failing readiness checks and stopping the server on shutdown")
+	flag.StringVar(&cfg.db.driver, "db-driver", "postgres", "Database driver (postgres|sqlite|memory)")
+	flag.StringVar(&cfg.db.dsn, "db-dsn", os.Getenv("HEROES_DB_DSN"), "PostgreSQL DSN or SQLite file name (in-memory SQLite database if empty)")
 	flag.IntVar(&cfg.db.maxOpenConns, "db-max-open-conns", 25, "PostgreSQL max open connections")
 	flag.IntVar(&cfg.db.maxIdleConns, "db-max-idle-conns", 25, "PostgreSQL max idle connections")
 	flag.StringVar(&cfg.db.maxIdleTime, "db-max-idle-time", "15m", "PostgreSQL max connection idle time")
-	flag.StringVar(&cfg.azure.tenantId, "azure-tenant", os.Getenv("AZURE_TENANT"), "AAD Tenant")
+	flag.DurationVar(&cfg.db.queryTimeout, "db-query-timeout", 3*time.Second, "Timeout for a single database query")
+	flag.StringVar(&cfg.db.migrate, "migrate", "", "Run schema migrations at startup (up|down|down-all|status); down reverts the latest migration, down-all all of them (dropping all data); all but up exit afterwards")
+	flag.StringVar(&cfg.azure.tenantId, "azure-tenant", os.Getenv("AZURE_TENANT"), "AAD Tenant (sets JWT issuer and discovery URL if they are not given)")
+	flag.StringVar(&cfg.jwt.Issuer, "jwt-issuer", os.Getenv("JWT_ISSUER"), "Expected JWT issuer (iss claim)")
+	flag.StringVar(&cfg.jwt.DiscoveryURL, "jwt-discovery-url", "", "OpenID Connect discovery URL for fetching the JWKS (defaults to issuer)")
+	jwtAudiences := flag.String("jwt-audiences", "api://4fac0887-b94f-4ea9-a8d3-06c7bca2a7bd", "Comma-separated list of accepted JWT audiences")
+	jwtAlgorithms := flag.String("jwt-algorithms", "RS256", "Comma-separated list of accepted JWT signature algorithms")
+	flag.StringVar(&cfg.jwt.JWKSFile, "jwt-jwks-file", "", "Local JSON Web Key Set file (no keys are fetched from the issuer)")
+	flag.StringVar(&cfg.jwt.JWKS, "jwt-jwks", os.Getenv("JWT_JWKS"), "Inline JSON Web Key Set (no keys are fetched from the issuer)")
+	flag.Float64Var(&cfg.limiter.rps, "limiter-rps", 2, "Rate limiter maximum requests per second per client")
+	flag.IntVar(&cfg.limiter.burst, "limiter-burst", 4, "Rate limiter maximum burst per client")
+	flag.BoolVar(&cfg.limiter.enabled, "limiter-enabled", true, "Enable rate limiter")
+	flag.StringVar(&cfg.events.webhookURL, "events-webhook-url", os.Getenv("HEROES_EVENTS_WEBHOOK_URL"), "URL hero change events are posted to (events are only logged if empty)")
+	flag.StringVar(&cfg.events.webhookSecret, "events-webhook-secret", os.Getenv("HEROES_EVENTS_WEBHOOK_SECRET"), "Secret signing the requests to the events webhook")
+	flag.DurationVar(&cfg.idempotency.ttl, "idempotency-ttl", 24*time.Hour, "Time responses to requests with an Idempotency-Key are replayed")
 	flag.Parse()
 
+	cfg.jwt.Audiences = strings.Split(*jwtAudiences, ",")
+	cfg.jwt.Algorithms = strings.Split(*jwtAlgorithms, ",")
+	if cfg.azure.tenantId != "" {
+		azure := middleware.AzureJwtConfig(cfg.azure.tenantId, cfg.jwt.Audiences)
+		if cfg.jwt.Issuer == "" {
+			cfg.jwt.Issuer = azure.Issuer
+		}
+		if cfg.jwt.DiscoveryURL == "" {
+			cfg.jwt.DiscoveryURL = azure.DiscoveryURL
+		}
+	}
+
 	//logger := log.New(os.Stdout, "", log.Ldate|log.Ltime)
 	logger := zerolog.New(os.Stdout).With().Timestamp().Logger()
 
-	db, err := openDB(cfg)
-	if err != nil {
-		logger.Fatal().Err(err)
-	}
+	var err error
+	var db *sql.DB
+	var models data.Models
+	switch cfg.db.driver {
+	case "memory":
+		models = data.NewMemoryModels()
+		logger.Printf("using in-memory database, data is lost when the server stops")
+	case "postgres", "sqlite":
+		db, err = openDB(cfg)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("cannot open database")
+		}
+
+		defer db.Close()
+		logger.Printf("database connection pool established")
+
+		if cfg.db.migrate != "" {
+			if cfg.db.driver != "postgres" {
+				logger.Fatal().Msg("schema migrations are only supported for postgres, the sqlite schema is created automatically")
+			}
 
-	defer db.Close()
-	logger.Printf("database connection pool established")
+			err = migrateDB(db, cfg.db.migrate, &logger)
+			if err != nil {
+				logger.Fatal().Err(err).Msg("schema migration failed")
+			}
+
+			if cfg.db.migrate != "up" {
+				return
+			}
+		}
+
+		if cfg.db.driver == "sqlite" {
+			models = data.NewSQLiteModels(db, cfg.db.queryTimeout)
+		} else {
+			models = data.NewModels(db, cfg.db.queryTimeout)
+		}
+	default:
+		logger.Fatal().Msgf("unknown database driver %q", cfg.db.driver)
+	}
 
 	app := &application{
 		config: cfg,
 		logger: &logger,
-		models: data.NewModels(db),
+		db:     db,
+		models: models,
+	}
+
+	app.publisher, err = newEventPublisher(cfg, &logger)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("invalid events configuration")
+	}
+
+	app.jwt, err = middleware.NewJwtMiddleware(cfg.jwt, jwtmiddleware.WithErrorHandler(app.jwtErrorHandler))
+	if err != nil {
+		logger.Fatal().Err(err).Msg("invalid JWT configuration")
 	}
 
 	err = app.serve()
@@ -69,6 +173,10 @@ func main() {
 }
 
 func openDB(cfg config) (*sql.DB, error) {
+	if cfg.db.driver == "sqlite" {
+		return openSQLite(cfg)
+	}
+
 	db, err := sql.Open("postgres", cfg.db.dsn)
 	if err != nil {
 		return nil, err
@@ -93,3 +201,70 @@ func openDB(cfg config) (*sql.DB, error) {
 
 	return db, nil
 }
+
+func openSQLite(cfg config) (*sql.DB, error) {
+	dsn := cfg.db.dsn
+	if dsn == "" {
+		dsn = ":memory:"
+	}
+
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite serializes writes anyway. A single connection that is never closed
+	// avoids busy errors and keeps in-memory databases alive.
+	db.SetMaxOpenConns(1)
+	db.SetMaxIdleConns(1)
+	db.SetConnMaxIdleTime(0)
+
+	err = data.CreateSQLiteSchema(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+func migrateDB(db *sql.DB, command string, logger *zerolog.Logger) error {
+	m, err := migrate.New(db, migrations.FS)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	switch command {
+	case "up":
+		applied, err := m.Up(ctx)
+		for _, migration := range applied {
+			logger.Info().Int64("version", migration.Version).Str("name", migration.Name).Msg("applied migration")
+		}
+		return err
+	case "down", "down-all":
+		var reverted []migrate.Migration
+		if command == "down" {
+			reverted, err = m.Down(ctx, 1)
+		} else {
+			reverted, err = m.DownAll(ctx)
+		}
+		for _, migration := range reverted {
+			logger.Info().Int64("version", migration.Version).Str("name", migration.Name).Msg("reverted migration")
+		}
+		return err
+	case "status":
+		statuses, err := m.Status(ctx)
+		for _, status := range statuses {
+			event := logger.Info().Int64("version", status.Version).Str("name", status.Name).Bool("applied", status.Applied)
+			if status.Applied {
+				event = event.Time("appliedAt", status.AppliedAt)
+			}
+			event.Msg("migration status")
+		}
+		return err
+	default:
+		return fmt.Errorf("unknown migrate command %q, must be up, down, down-all or status", command)
+	}
+}
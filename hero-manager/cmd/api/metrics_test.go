@@ -0,0 +1,57 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricsEndpoint(t *testing.T) {
+	logger := zerolog.Nop()
+	app := &application{
+		config: config{
+			env: "Test",
+		},
+		logger: &logger,
+	}
+	app.config.limiter.enabled = true
+	app.config.limiter.rps = 1
+	app.config.limiter.burst = 1
+
+	ts := httptest.NewServer(testRoutes(t, app))
+	defer ts.Close()
+
+	rs, err := ts.Client().Get(ts.URL + "/v1/healthcheck")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs.Body.Close()
+
+	// Scrapes share neither the rate limit of the client nor are they counted
+	var body []byte
+	for i := 0; i < 3; i++ {
+		rs, err = ts.Client().Get(ts.URL + "/metrics")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, http.StatusOK, rs.StatusCode)
+		assert.Contains(t, rs.Header.Get("Content-Type"), "text/plain")
+
+		body, err = io.ReadAll(rs.Body)
+		rs.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	assert.Contains(t, string(body), `heroes_http_requests_total{method="GET",route="/v1/healthcheck",status="200"} 1`)
+	assert.Contains(t, string(body), `heroes_http_request_duration_seconds_bucket{method="GET",route="/v1/healthcheck",status="200",le="+Inf"} 1`)
+	assert.Contains(t, string(body), "heroes_http_requests_in_flight 0")
+	assert.NotContains(t, string(body), `route="/metrics"`)
+	assert.Contains(t, string(body), "go_goroutines")
+}
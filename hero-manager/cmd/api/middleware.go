@@ -1,10 +1,72 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"net"
 	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+	"heroes.rainerstropek.com/internal/data"
+	"heroes.rainerstropek.com/internal/middleware"
 )
 
+// logRequests writes one access log line per request. Every request gets an
+// id that is included in the log lines, error responses and the X-Request-ID
+// response header. Clients can pass their own id in the X-Request-ID request
+// header, e.g. to correlate requests across services. logRequests must be
+// the first middleware so that all other ones can use the id.
+func (app *application) logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set("X-Request-ID", id)
+
+		r = contextWithRequestID(r, id)
+		r, info := contextWithRequestInfo(r)
+		sw := newStatusRecorder(w)
+		next.ServeHTTP(sw, r)
+
+		route := info.route
+		if route == "" {
+			route = "unmatched"
+		}
+
+		app.logger.Info().
+			Str("request_id", id).
+			Str("method", r.Method).
+			Str("route", route).
+			Int("status", sw.status).
+			Int("bytes", sw.bytes).
+			Dur("duration", time.Since(start)).
+			Str("subject", info.subject).
+			Msg("request handled")
+	})
+}
+
+// validRequestID reports whether a client-provided request id can be used.
+// Ids are limited to printable ASCII without spaces so that they cannot
+// mess up logs.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+
+	for i := 0; i < len(id); i++ {
+		if id[i] < '!' || id[i] > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
 func (app *application) recoverPanic(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
@@ -27,3 +89,192 @@ func (app *application) enableCORS(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// authenticate only calls next if the request carries a valid bearer token.
+// The token's subject is passed on to the models so that changes are audited
+// with it, and to the access log. Without a JWT middleware (e.g. in tests) all requests are rejected.
+func (app *application) authenticate(next http.Handler) http.Handler {
+	if app.jwt == nil {
+		return http.HandlerFunc(app.jwtMissingResponse)
+	}
+
+	return app.jwt.CheckJWT(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subject, ok := middleware.Subject(r); ok {
+			setSubject(r, subject)
+			r = r.WithContext(data.ContextWithActor(r.Context(), subject))
+		}
+
+		next.ServeHTTP(w, r)
+	}))
+}
+
+// requirePermission only calls next if the validated JWT of the request
+// grants the given permission. It must be used behind the JWT middleware.
+func (app *application) requirePermission(permission string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !middleware.HasPermission(r, permission) {
+			app.forbiddenResponse(w, r, permission)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
+
+// rateLimiter holds the token buckets of the clients of rateLimitPerIP and
+// rateLimitPerSubject.
+type rateLimiter struct {
+	mu      sync.Mutex
+	clients map[string]*rateLimitedClient
+}
+
+type rateLimitedClient struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// newRateLimiter returns an empty rateLimiter. A background goroutine evicts
+// clients that have not been seen recently until ctx is done.
+func newRateLimiter(ctx context.Context) *rateLimiter {
+	l := &rateLimiter{clients: make(map[string]*rateLimitedClient)}
+
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			l.mu.Lock()
+			for key, client := range l.clients {
+				if time.Since(client.lastSeen) > 3*time.Minute {
+					delete(l.clients, key)
+				}
+			}
+			l.mu.Unlock()
+		}
+	}()
+
+	return l
+}
+
+// rateLimitPerIP limits anonymous requests per IP address with a token bucket.
+func (app *application) rateLimitPerIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.allowClientIP(w, r) {
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// rateLimitPerSubject limits authenticated requests per JWT subject with a
+// token bucket, so that clients behind the same proxy do not share a limit.
+// It must be used behind the JWT middleware, which limits requests it
+// rejects per IP address (see jwtErrorHandler).
+func (app *application) rateLimitPerSubject(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		subject, ok := middleware.Subject(r)
+		if !ok {
+			if app.allowClientIP(w, r) {
+				next.ServeHTTP(w, r)
+			}
+			return
+		}
+
+		if app.allowClient(w, r, "sub:"+subject) {
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// allowClientIP takes a token from the bucket of the IP address of the
+// request. If the request must be rejected, it writes the response and
+// returns false.
+func (app *application) allowClientIP(w http.ResponseWriter, r *http.Request) bool {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return false
+	}
+
+	return app.allowClient(w, r, "ip:"+ip)
+}
+
+// allowClient takes a token from the bucket of a client. If the request must
+// be rejected, it writes the response and returns false.
+func (app *application) allowClient(w http.ResponseWriter, r *http.Request, key string) bool {
+	if !app.config.limiter.enabled || app.limiter == nil {
+		return true
+	}
+
+	l := app.limiter
+	l.mu.Lock()
+
+	if _, found := l.clients[key]; !found {
+		l.clients[key] = &rateLimitedClient{
+			limiter: rate.NewLimiter(rate.Limit(app.config.limiter.rps), app.config.limiter.burst),
+		}
+	}
+
+	l.clients[key].lastSeen = time.Now()
+	reservation := l.clients[key].limiter.Reserve()
+
+	l.mu.Unlock()
+
+	if !reservation.OK() {
+		// The request can never be served (e.g. with a burst of 0), so there
+		// is no point in telling the client when to retry
+		app.rateLimitExceededResponse(w, r, 0)
+		return false
+	}
+
+	if delay := reservation.Delay(); delay > 0 {
+		reservation.Cancel()
+		app.rateLimitExceededResponse(w, r, delay)
+		return false
+	}
+
+	return true
+}
+
+// statusRecorder captures the status code and size of a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int
+	wroteHeader bool
+}
+
+func newStatusRecorder(w http.ResponseWriter) *statusRecorder {
+	return &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+}
+
+func (sw *statusRecorder) WriteHeader(status int) {
+	if !sw.wroteHeader {
+		sw.status = status
+		sw.wroteHeader = true
+	}
+
+	sw.ResponseWriter.WriteHeader(status)
+}
+
+func (sw *statusRecorder) Write(b []byte) (int, error) {
+	sw.wroteHeader = true
+	n, err := sw.ResponseWriter.Write(b)
+	sw.bytes += n
+	return n, err
+}
+
+func (sw *statusRecorder) Flush() {
+	if flusher, ok := sw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (sw *statusRecorder) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
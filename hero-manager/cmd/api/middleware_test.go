@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"heroes.rainerstropek.com/internal/jwttest"
+	"heroes.rainerstropek.com/internal/middleware"
+)
+
+func TestRateLimitPerIP(t *testing.T) {
+	logger := zerolog.Nop()
+	app := &application{
+		config: config{
+			env: "Test",
+		},
+		logger: &logger,
+	}
+	app.config.limiter.enabled = true
+	app.config.limiter.rps = 1
+	app.config.limiter.burst = 2
+
+	handler := testRoutes(t, app)
+
+	status := func(remoteAddr string) (int, string) {
+		rr := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/v1/healthcheck", nil)
+		r.RemoteAddr = remoteAddr
+		handler.ServeHTTP(rr, r)
+		return rr.Code, rr.Header().Get("Retry-After")
+	}
+
+	for i := 0; i < 2; i++ {
+		code, _ := status("192.0.2.1:1234")
+		assert.Equal(t, http.StatusOK, code)
+	}
+
+	code, retryAfter := status("192.0.2.1:1234")
+	assert.Equal(t, http.StatusTooManyRequests, code)
+	assert.Equal(t, "1", retryAfter)
+
+	// Other clients have their own bucket
+	code, _ = status("192.0.2.2:1234")
+	assert.Equal(t, http.StatusOK, code)
+}
+
+func TestRateLimitPerSubject(t *testing.T) {
+	app, ts := newTestServer(t)
+	app.config.limiter.enabled = true
+	app.config.limiter.rps = 1
+	app.config.limiter.burst = 2
+
+	statuses := func(token string) []int {
+		var statuses []int
+		for i := 0; i < 3; i++ {
+			rs := doRequest(t, ts, http.MethodGet, "/v1/claims", token, "")
+			statuses = append(statuses, rs.StatusCode)
+		}
+		return statuses
+	}
+
+	// All requests come from the same IP address, but every subject has its
+	// own bucket
+	alice, err := jwttest.Mint("alice", middleware.CustomClaimsExample{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, err := jwttest.Mint("bob", middleware.CustomClaimsExample{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests}, statuses(alice))
+	assert.Equal(t, []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests}, statuses(bob))
+
+	// Requests failing validation are limited per IP address
+	assert.Equal(t, []int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusTooManyRequests}, statuses("not-a-jwt"))
+	assert.Equal(t, http.StatusTooManyRequests, doRequest(t, ts, http.MethodGet, "/v1/claims", "", "").StatusCode)
+}
+
+func TestRateLimitWithoutBurst(t *testing.T) {
+	app, ts := newTestServer(t)
+	app.config.limiter.enabled = true
+	app.config.limiter.rps = 1
+	app.config.limiter.burst = 0
+
+	rs := doRequest(t, ts, http.MethodGet, "/v1/healthcheck", "", "")
+	assert.Equal(t, http.StatusTooManyRequests, rs.StatusCode)
+	assert.Empty(t, rs.Header.Get("Retry-After"))
+}
+
+func TestLogRequests(t *testing.T) {
+	app, ts := newTestServer(t)
+	var logs bytes.Buffer
+	logger := zerolog.New(&logs)
+	app.logger = &logger
+	token := mintTestToken(t, "Heroes.Read")
+
+	rs := doRequest(t, ts, http.MethodGet, "/v1/heroes/42", token, "", "X-Request-ID", "trace-4711")
+	assert.Equal(t, "trace-4711", rs.Header.Get("X-Request-ID"))
+	assert.Equal(t, "trace-4711", decodeProblem(t, rs).RequestID)
+
+	var line struct {
+		RequestID string  `json:"request_id"`
+		Method    string  `json:"method"`
+		Route     string  `json:"route"`
+		Status    int     `json:"status"`
+		Bytes     int     `json:"bytes"`
+		Duration  float64 `json:"duration"`
+		Subject   string  `json:"subject"`
+	}
+	err := json.Unmarshal(logs.Bytes(), &line)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "trace-4711", line.RequestID)
+	assert.Equal(t, http.MethodGet, line.Method)
+	assert.Equal(t, "/v1/heroes/:id", line.Route)
+	assert.Equal(t, http.StatusNotFound, line.Status)
+	assert.Positive(t, line.Bytes)
+	assert.Equal(t, "test-user", line.Subject)
+
+	// Invalid ids are replaced
+	rs = doRequest(t, ts, http.MethodGet, "/v1/healthcheck", "", "", "X-Request-ID", "two words")
+	assert.Len(t, rs.Header.Get("X-Request-ID"), 32)
+}
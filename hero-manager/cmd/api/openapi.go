@@ -0,0 +1,566 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"heroes.rainerstropek.com/internal/middleware"
+)
+
+// openAPIComponents is the hand-written part of the OpenAPI 3.1 document:
+// info, tags and the components (schemas, parameters, responses, ...). The
+// paths are generated from the registered routes by openAPIDocument.
+//
+//go:embed openapi.json
+var openAPIComponents []byte
+
+func (app *application) openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(app.openAPI)
+}
+
+// jsonObject is an object of the OpenAPI document.
+type jsonObject = map[string]interface{}
+
+// apiOperation documents what cannot be derived from the registration of a
+// route. The path, method, path parameters, security, required permission
+// and the error responses following from them are added by openAPIDocument.
+type apiOperation struct {
+	id          string
+	summary     string
+	description string
+	tag         string
+	parameters  []jsonObject // query and header parameters
+	requestBody jsonObject
+	responses   map[string]jsonObject
+
+	// "strong" or "weak" if GET requests answer matching If-None-Match
+	// headers with 304
+	etag string
+}
+
+// routeParam matches the parameters of httprouter patterns, custom methods
+// (e.g. /v1/heroes:import) are no parameters.
+var routeParam = regexp.MustCompile(`/:(\w+)`)
+
+// openAPIDocument returns the OpenAPI document of the registered routes.
+// Routes of /v2 are documented by the operation of the /v1 route, with the
+// V2 variants of the hero schemas.
+func (app *application) openAPIDocument() ([]byte, error) {
+	var document jsonObject
+	err := json.Unmarshal(openAPIComponents, &document)
+	if err != nil {
+		return nil, err
+	}
+
+	schemas := document["components"].(jsonObject)["schemas"].(jsonObject)
+
+	paths := make(jsonObject)
+	for _, route := range app.registered {
+		key := route.method + " " + route.pattern
+		suffix := ""
+		if strings.HasPrefix(route.pattern, apiV2.prefix()+"/") {
+			key = route.method + " " + apiV1.prefix() + strings.TrimPrefix(route.pattern, apiV2.prefix())
+			suffix = "V2"
+		}
+
+		op, ok := apiOperations[key]
+		if !ok {
+			return nil, fmt.Errorf("route %s %s is not documented", route.method, route.pattern)
+		}
+
+		path := routeParam.ReplaceAllString(route.pattern, "/{$1}")
+		item, _ := paths[path].(jsonObject)
+		if item == nil {
+			item = make(jsonObject)
+			paths[path] = item
+		}
+
+		operation := op.document(route)
+		operation["operationId"] = op.id + suffix
+		if suffix != "" {
+			operation = withSchemaVariant(operation, suffix, schemas).(jsonObject)
+		}
+
+		item[strings.ToLower(route.method)] = operation
+	}
+
+	document["paths"] = paths
+
+	return json.Marshal(document)
+}
+
+// document returns the operation object of a route.
+func (op apiOperation) document(route route) jsonObject {
+	operation := jsonObject{
+		"summary": op.summary,
+		"tags":    []string{op.tag},
+	}
+
+	description := op.description
+	if route.permission != "" {
+		if description != "" {
+			description += "\n\n"
+		}
+		description += fmt.Sprintf("Requires the `%s` permission.", route.permission)
+	}
+	if description != "" {
+		operation["description"] = description
+	}
+
+	var parameters []jsonObject
+	for _, match := range routeParam.FindAllStringSubmatch(route.pattern, -1) {
+		parameters = append(parameters, componentRef("parameters", match[1]))
+	}
+	parameters = append(parameters, op.parameters...)
+
+	responses := make(jsonObject)
+	for status, response := range op.responses {
+		responses[status] = response
+	}
+
+	if op.etag != "" {
+		parameters = append(parameters, componentRef("parameters", "If-None-Match"))
+		responses["304"] = componentRef("responses", "NotModified")
+
+		if op.etag == "weak" {
+			ok := make(jsonObject)
+			for key, value := range responses["200"].(jsonObject) {
+				ok[key] = value
+			}
+
+			headers := jsonObject{"ETag": componentRef("headers", "WeakETag")}
+			if existing, found := ok["headers"].(jsonObject); found {
+				for name, header := range existing {
+					headers[name] = header
+				}
+			}
+			ok["headers"] = headers
+			responses["200"] = ok
+		}
+	}
+
+	if len(parameters) > 0 {
+		operation["parameters"] = parameters
+	}
+	if op.requestBody != nil {
+		operation["requestBody"] = op.requestBody
+	}
+
+	if route.public {
+		operation["security"] = []interface{}{}
+	} else {
+		setDefault(responses, "401", componentRef("responses", "Unauthorized"))
+		if route.permission != "" {
+			setDefault(responses, "403", componentRef("responses", "Forbidden"))
+		}
+		setDefault(responses, "429", componentRef("responses", "TooManyRequests"))
+	}
+	setDefault(responses, "500", componentRef("responses", "ServerError"))
+	operation["responses"] = responses
+
+	return operation
+}
+
+func setDefault(responses jsonObject, status string, response jsonObject) {
+	if _, found := responses[status]; !found {
+		responses[status] = response
+	}
+}
+
+// withSchemaVariant returns a copy of v referring to the variants of schemas
+// with the given suffix (e.g. HeroV2 instead of Hero) where they exist.
+func withSchemaVariant(v interface{}, suffix string, schemas jsonObject) interface{} {
+	switch v := v.(type) {
+	case jsonObject:
+		result := make(jsonObject, len(v))
+		for key, value := range v {
+			result[key] = withSchemaVariant(value, suffix, schemas)
+		}
+
+		if ref, ok := v["$ref"].(string); ok {
+			name := strings.TrimPrefix(ref, "#/components/schemas/")
+			if _, found := schemas[name+suffix]; name != ref && found {
+				result["$ref"] = ref + suffix
+			}
+		}
+		return result
+	case []jsonObject:
+		result := make([]jsonObject, len(v))
+		for i, value := range v {
+			result[i] = withSchemaVariant(value, suffix, schemas).(jsonObject)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, value := range v {
+			result[i] = withSchemaVariant(value, suffix, schemas)
+		}
+		return result
+	default:
+		return v
+	}
+}
+
+func componentRef(kind, name string) jsonObject {
+	return jsonObject{"$ref": "#/components/" + kind + "/" + name}
+}
+
+func schemaRef(name string) jsonObject {
+	return componentRef("schemas", name)
+}
+
+// jsonResponse documents a response with a JSON body. headers are pairs of
+// header names and header objects.
+func jsonResponse(description string, schema jsonObject, headers ...interface{}) jsonObject {
+	response := jsonObject{
+		"description": description,
+		"content":     jsonObject{"application/json": jsonObject{"schema": schema}},
+	}
+
+	if len(headers) > 0 {
+		h := make(jsonObject)
+		for i := 0; i+1 < len(headers); i += 2 {
+			h[headers[i].(string)] = headers[i+1]
+		}
+		response["headers"] = h
+	}
+
+	return response
+}
+
+func jsonRequestBody(schema jsonObject) jsonObject {
+	return jsonObject{
+		"required": true,
+		"content":  jsonObject{"application/json": jsonObject{"schema": schema}},
+	}
+}
+
+func locationHeader(resource string) jsonObject {
+	return jsonObject{"description": "URL of the " + resource, "schema": jsonObject{"type": "string"}}
+}
+
+// errorResponses refers to the responses of components by name.
+func errorResponses(names ...string) map[string]jsonObject {
+	statuses := map[string]string{
+		"BadRequest":           "400",
+		"Forbidden":            "403",
+		"NotFound":             "404",
+		"EditConflict":         "409",
+		"IdempotencyKeyInUse":  "409",
+		"PreconditionFailed":   "412",
+		"UnsupportedMediaType": "415",
+		"ValidationFailed":     "422",
+	}
+
+	responses := make(map[string]jsonObject)
+	for _, name := range names {
+		responses[statuses[name]] = componentRef("responses", name)
+	}
+	return responses
+}
+
+func withResponse(responses map[string]jsonObject, status string, response jsonObject) map[string]jsonObject {
+	responses[status] = response
+	return responses
+}
+
+// Building blocks of apiOperations
+var (
+	etagHeader    = componentRef("headers", "ETag")
+	linkHeader    = componentRef("headers", "Link")
+	messageSchema = schemaRef("Message")
+
+	heroFilterParams = []jsonObject{
+		componentRef("parameters", "name"),
+		componentRef("parameters", "abilities"),
+		componentRef("parameters", "q"),
+		componentRef("parameters", "first_seen_from"),
+		componentRef("parameters", "first_seen_to"),
+		componentRef("parameters", "can_fly"),
+		componentRef("parameters", "include_deleted"),
+	}
+
+	healthResponse = map[string]jsonObject{"200": jsonResponse("The server is alive", schemaRef("Health"))}
+)
+
+// apiOperations documents the registered routes by method and pattern. /v2
+// routes use the operation of the /v1 route.
+var apiOperations = map[string]apiOperation{
+	"GET /v1/healthcheck": {
+		id:        "healthcheck",
+		summary:   "Liveness (legacy alias of /v1/healthz)",
+		tag:       "Health",
+		responses: healthResponse,
+	},
+	"GET /v1/healthz": {
+		id:          "liveness",
+		summary:     "Liveness",
+		description: "Does not check any dependencies.",
+		tag:         "Health",
+		responses:   healthResponse,
+	},
+	"GET /v1/readyz": {
+		id:          "readiness",
+		summary:     "Readiness",
+		description: "Pings the database and reports connection pool statistics. Fails while the server is shutting down, so that load balancers drain traffic.",
+		tag:         "Health",
+		responses: map[string]jsonObject{
+			"200": jsonResponse("The server can handle requests", schemaRef("Readiness")),
+			"503": jsonResponse("The database does not respond or the server is shutting down", schemaRef("Readiness")),
+		},
+	},
+	"GET /metrics": {
+		id:      "metrics",
+		summary: "Prometheus metrics",
+		tag:     "Health",
+		responses: map[string]jsonObject{"200": {
+			"description": "Metrics in Prometheus text exposition format",
+			"content":     jsonObject{"text/plain": jsonObject{"schema": jsonObject{"type": "string"}}},
+		}},
+	},
+	"GET /v1/openapi.json": {
+		id:        "openapi",
+		summary:   "This OpenAPI document",
+		tag:       "Health",
+		responses: map[string]jsonObject{"200": jsonResponse("OpenAPI 3.1 document", jsonObject{"type": "object"})},
+	},
+
+	"GET /v1/heroes": {
+		id:          "listHeroes",
+		summary:     "List heroes",
+		description: "Offset pagination by default. With `cursor`, keyset pagination is used and `page` is ignored. Listing deleted heroes requires the `" + middleware.PermissionAdmin + "` permission.",
+		tag:         "Heroes",
+		parameters: append([]jsonObject{
+			componentRef("parameters", "page"),
+			componentRef("parameters", "page_size"),
+			componentRef("parameters", "cursor"),
+			componentRef("parameters", "heroSort"),
+		}, heroFilterParams...),
+		responses: withResponse(errorResponses("Forbidden", "ValidationFailed"),
+			"200", jsonResponse("A page of heroes", schemaRef("HeroList"), "Link", linkHeader)),
+		etag: "weak",
+	},
+	"POST /v1/heroes": {
+		id:          "createHero",
+		summary:     "Create a hero",
+		description: "With an `Idempotency-Key`, the first response is stored and replayed for retries until it expires (24 hours by default). Reusing a key for a different request fails with 422.",
+		tag:         "Heroes",
+		parameters:  []jsonObject{componentRef("parameters", "Idempotency-Key")},
+		requestBody: jsonRequestBody(schemaRef("HeroInput")),
+		responses: withResponse(errorResponses("BadRequest", "IdempotencyKeyInUse", "ValidationFailed"),
+			"201", jsonResponse("The created hero", schemaRef("Hero"),
+				"Location", locationHeader("hero"),
+				"Idempotent-Replayed", componentRef("headers", "Idempotent-Replayed"))),
+	},
+	"POST /v1/heroes:import": {
+		id:          "importHeroes",
+		summary:     "Import heroes",
+		description: "Valid heroes are stored in batches, invalid lines are skipped and reported.",
+		tag:         "Heroes",
+		requestBody: jsonObject{
+			"required": true,
+			"content": jsonObject{
+				"application/x-ndjson": jsonObject{"schema": jsonObject{"type": "string", "description": "One HeroInput per line, abilities may be a comma-separated string"}},
+				"text/csv":             jsonObject{"schema": jsonObject{"type": "string", "description": "Header row naming any of the columns " + strings.Join(heroCSVColumns, ", ")}},
+			},
+		},
+		responses: withResponse(errorResponses("BadRequest", "UnsupportedMediaType"),
+			"200", jsonResponse("Import report", schemaRef("ImportReport"))),
+	},
+	"GET /v1/heroes:export": {
+		id:      "exportHeroes",
+		summary: "Export heroes",
+		tag:     "Heroes",
+		parameters: append([]jsonObject{
+			{"name": "format", "in": "query", "schema": jsonObject{"type": "string", "enum": []string{"ndjson", "csv"}, "default": "ndjson"}},
+			componentRef("parameters", "heroSort"),
+		}, heroFilterParams...),
+		responses: withResponse(errorResponses("Forbidden", "ValidationFailed"), "200", jsonObject{
+			"description": "All matching heroes",
+			"content": jsonObject{
+				"application/x-ndjson": jsonObject{"schema": jsonObject{"type": "string", "description": "One Hero per line"}},
+				"text/csv":             jsonObject{"schema": jsonObject{"type": "string"}},
+			},
+		}),
+	},
+	"GET /v1/heroes/:id": {
+		id:        "showHero",
+		summary:   "Show a hero",
+		tag:       "Heroes",
+		responses: withResponse(errorResponses("NotFound"), "200", jsonResponse("The hero", schemaRef("Hero"), "ETag", etagHeader)),
+		etag:      "strong",
+	},
+	"PUT /v1/heroes/:id": {
+		id:          "updateHero",
+		summary:     "Replace a hero",
+		tag:         "Heroes",
+		parameters:  []jsonObject{componentRef("parameters", "If-Match")},
+		requestBody: jsonRequestBody(schemaRef("HeroInput")),
+		responses: withResponse(errorResponses("BadRequest", "NotFound", "EditConflict", "PreconditionFailed", "ValidationFailed"),
+			"200", jsonResponse("The updated hero", schemaRef("Hero"), "ETag", etagHeader)),
+	},
+	"PATCH /v1/heroes/:id": {
+		id:          "patchHero",
+		summary:     "Update a hero (JSON merge patch)",
+		description: "Fields missing in the body are left untouched, abilities are replaced as a whole.",
+		tag:         "Heroes",
+		parameters:  []jsonObject{componentRef("parameters", "If-Match")},
+		requestBody: jsonRequestBody(schemaRef("HeroPatch")),
+		responses: withResponse(errorResponses("BadRequest", "NotFound", "EditConflict", "PreconditionFailed", "ValidationFailed"),
+			"200", jsonResponse("The updated hero", schemaRef("Hero"), "ETag", etagHeader)),
+	},
+	"DELETE /v1/heroes/:id": {
+		id:          "deleteHero",
+		summary:     "Delete a hero",
+		description: "Soft deletes the hero and removes it from all teams and rivalries. It can be restored until it is purged.",
+		tag:         "Heroes",
+		responses:   withResponse(errorResponses("NotFound"), "200", jsonResponse("Deleted", messageSchema)),
+	},
+	"POST /v1/heroes/:id/restore": {
+		id:        "restoreHero",
+		summary:   "Restore a deleted hero",
+		tag:       "Heroes",
+		responses: withResponse(errorResponses("NotFound"), "200", jsonResponse("The restored hero", schemaRef("Hero"), "ETag", etagHeader)),
+	},
+	"POST /v1/heroes/:id/purge": {
+		id:        "purgeHero",
+		summary:   "Permanently delete a hero",
+		tag:       "Heroes",
+		responses: withResponse(errorResponses("NotFound"), "200", jsonResponse("Purged", messageSchema)),
+	},
+	"GET /v1/heroes/:id/history": {
+		id:      "heroHistory",
+		summary: "List the audit events of a hero",
+		tag:     "Heroes",
+		parameters: []jsonObject{
+			componentRef("parameters", "page"),
+			componentRef("parameters", "page_size"),
+			{"name": "sort", "in": "query", "schema": jsonObject{"type": "string", "enum": []string{"id", "-id"}, "default": "-id"}},
+		},
+		responses: withResponse(errorResponses("NotFound", "ValidationFailed"), "200", jsonResponse("A page of audit events", jsonObject{
+			"type":     "object",
+			"required": []string{"metadata", "events"},
+			"properties": jsonObject{
+				"metadata": schemaRef("Metadata"),
+				"events":   jsonObject{"type": "array", "items": schemaRef("AuditEvent")},
+			},
+		}, "Link", linkHeader)),
+		etag: "weak",
+	},
+	"GET /v1/heroes/:id/teams": {
+		id:        "heroTeams",
+		summary:   "List the teams of a hero",
+		tag:       "Teams",
+		responses: withResponse(errorResponses("NotFound"), "200", jsonResponse("Teams sorted by name", schemaRef("TeamArray"))),
+		etag:      "weak",
+	},
+	"GET /v1/heroes/:id/rivals": {
+		id:        "heroRivals",
+		summary:   "List the rivals of a hero",
+		tag:       "Heroes",
+		responses: withResponse(errorResponses("NotFound"), "200", jsonResponse("Heroes sorted by name", schemaRef("HeroArray"))),
+		etag:      "weak",
+	},
+	"PUT /v1/heroes/:id/rivals/:rivalId": {
+		id:        "addHeroRival",
+		summary:   "Make two heroes rivals",
+		tag:       "Heroes",
+		responses: withResponse(errorResponses("NotFound", "ValidationFailed"), "200", jsonResponse("Added, rivalries are symmetric", messageSchema)),
+	},
+	"DELETE /v1/heroes/:id/rivals/:rivalId": {
+		id:        "removeHeroRival",
+		summary:   "End a rivalry",
+		tag:       "Heroes",
+		responses: withResponse(errorResponses("NotFound", "ValidationFailed"), "200", jsonResponse("Removed", messageSchema)),
+	},
+
+	"POST /v1/generate": {
+		id:        "generateDemoData",
+		summary:   "Generate 20 random heroes",
+		tag:       "Heroes",
+		responses: map[string]jsonObject{"201": jsonResponse("Created", messageSchema)},
+	},
+
+	"GET /v1/teams": {
+		id:      "listTeams",
+		summary: "List teams",
+		tag:     "Teams",
+		parameters: []jsonObject{
+			componentRef("parameters", "page"),
+			componentRef("parameters", "page_size"),
+			{"name": "sort", "in": "query", "description": "Comma-separated columns, prefix with - for descending order", "schema": jsonObject{"type": "string", "default": "id"}, "example": "name"},
+		},
+		responses: withResponse(errorResponses("ValidationFailed"), "200", jsonResponse("A page of teams", jsonObject{
+			"type":     "object",
+			"required": []string{"metadata", "teams"},
+			"properties": jsonObject{
+				"metadata": schemaRef("Metadata"),
+				"teams":    jsonObject{"type": "array", "items": schemaRef("Team")},
+			},
+		}, "Link", linkHeader)),
+		etag: "weak",
+	},
+	"POST /v1/teams": {
+		id:          "createTeam",
+		summary:     "Create a team",
+		tag:         "Teams",
+		requestBody: jsonRequestBody(schemaRef("TeamInput")),
+		responses: withResponse(errorResponses("BadRequest", "ValidationFailed"),
+			"201", jsonResponse("The created team", schemaRef("Team"), "Location", locationHeader("team"), "ETag", etagHeader)),
+	},
+	"GET /v1/teams/:id": {
+		id:        "showTeam",
+		summary:   "Show a team",
+		tag:       "Teams",
+		responses: withResponse(errorResponses("NotFound"), "200", jsonResponse("The team", schemaRef("Team"), "ETag", etagHeader)),
+		etag:      "strong",
+	},
+	"PUT /v1/teams/:id": {
+		id:          "updateTeam",
+		summary:     "Replace a team",
+		tag:         "Teams",
+		parameters:  []jsonObject{componentRef("parameters", "If-Match")},
+		requestBody: jsonRequestBody(schemaRef("TeamInput")),
+		responses: withResponse(errorResponses("BadRequest", "NotFound", "EditConflict", "PreconditionFailed", "ValidationFailed"),
+			"200", jsonResponse("The updated team", schemaRef("Team"), "ETag", etagHeader)),
+	},
+	"DELETE /v1/teams/:id": {
+		id:          "deleteTeam",
+		summary:     "Delete a team",
+		description: "Permanently deletes the team and its memberships, its members are not deleted.",
+		tag:         "Teams",
+		responses:   withResponse(errorResponses("NotFound"), "200", jsonResponse("Deleted", messageSchema)),
+	},
+	"GET /v1/teams/:id/members": {
+		id:        "teamMembers",
+		summary:   "List the members of a team",
+		tag:       "Teams",
+		responses: withResponse(errorResponses("NotFound"), "200", jsonResponse("Heroes sorted by name", schemaRef("HeroArray"))),
+		etag:      "weak",
+	},
+	"PUT /v1/teams/:id/members/:heroId": {
+		id:          "addTeamMember",
+		summary:     "Add a hero to a team",
+		description: "Adding a member again has no effect. Deleted heroes cannot join teams.",
+		tag:         "Teams",
+		responses:   withResponse(errorResponses("NotFound"), "200", jsonResponse("Added", messageSchema)),
+	},
+	"DELETE /v1/teams/:id/members/:heroId": {
+		id:        "removeTeamMember",
+		summary:   "Remove a hero from a team",
+		tag:       "Teams",
+		responses: withResponse(errorResponses("NotFound"), "200", jsonResponse("Removed", messageSchema)),
+	},
+	"GET /v1/claims": {
+		id:        "showClaims",
+		summary:   "Show the claims of the caller's token",
+		tag:       "Auth",
+		responses: map[string]jsonObject{"200": jsonResponse("Validated claims", jsonObject{"type": "object"})},
+	},
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"heroes.rainerstropek.com/internal/data"
+)
+
+func TestOpenAPIDocumentsAllRoutes(t *testing.T) {
+	app, ts := newTestServer(t)
+
+	// The document is public
+	rs, err := http.Get(ts.URL + "/v1/openapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Body.Close()
+
+	assert.Equal(t, http.StatusOK, rs.StatusCode)
+	assert.Equal(t, "application/json", rs.Header.Get("Content-Type"))
+
+	var document struct {
+		OpenAPI string                                `json:"openapi"`
+		Paths   map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	err = json.NewDecoder(rs.Body).Decode(&document)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "3.1.0", document.OpenAPI)
+
+	documented := make(map[string]bool)
+	for path, item := range document.Paths {
+		for method := range item {
+			if method != "parameters" {
+				documented[strings.ToUpper(method)+" "+path] = true
+			}
+		}
+	}
+
+	// httprouter's :param becomes {param}
+	param := regexp.MustCompile(`/:(\w+)`)
+
+	registered := make(map[string]bool)
+	for _, route := range app.registered {
+		registered[route.method+" "+param.ReplaceAllString(route.pattern, "/{$1}")] = true
+	}
+
+	// Custom methods are registered outside of httprouter
+	assert.Contains(t, registered, "POST /v1/heroes:import")
+	assert.Contains(t, registered, "PUT /v1/heroes/{id}/rivals/{rivalId}")
+
+	for operation := range registered {
+		assert.True(t, documented[operation], "%s is not documented", operation)
+	}
+	for operation := range documented {
+		assert.True(t, registered[operation], "%s is documented, but not registered", operation)
+	}
+
+	// /v2 documents heroes with abilities as an array
+	assert.Contains(t, string(document.Paths["/v2/heroes/{id}"]["get"]), `"#/components/schemas/HeroV2"`)
+	assert.Contains(t, string(document.Paths["/v2/heroes"]["get"]), `"#/components/schemas/HeroListV2"`)
+	assert.NotContains(t, string(document.Paths["/v1/heroes/{id}"]["get"]), `V2"`)
+	assert.Contains(t, string(document.Paths["/v1/heroes/{id}"]["get"]), `"#/components/schemas/Hero"`)
+
+	// Operations of routes that have been removed must be removed, too
+	used := make(map[string]bool)
+	for _, route := range app.registered {
+		used[route.method+" "+strings.Replace(route.pattern, apiV2.prefix()+"/", apiV1.prefix()+"/", 1)] = true
+	}
+	for key := range apiOperations {
+		assert.True(t, used[key], "operation of %s is not used", key)
+	}
+}
+
+// Security and permissions are generated from the registration of routes,
+// which must match how they are served.
+func TestOpenAPISecurityMatchesRoutes(t *testing.T) {
+	app, ts := newTestServer(t)
+	noPermissions := mintTestToken(t, "")
+
+	ids := regexp.MustCompile(`/:\w+`)
+	for _, route := range app.registered {
+		path := ids.ReplaceAllString(route.pattern, "/1")
+
+		rs := doRequest(t, ts, route.method, path, "", "")
+		if route.public {
+			assert.NotEqual(t, http.StatusUnauthorized, rs.StatusCode, "%s %s", route.method, path)
+			continue
+		}
+		assert.Equal(t, http.StatusUnauthorized, rs.StatusCode, "%s %s", route.method, path)
+
+		rs = doRequest(t, ts, route.method, path, noPermissions, "")
+		if route.permission != "" {
+			assert.Equal(t, http.StatusForbidden, rs.StatusCode, "%s %s", route.method, path)
+		} else {
+			assert.NotEqual(t, http.StatusForbidden, rs.StatusCode, "%s %s", route.method, path)
+		}
+	}
+}
+
+func TestOpenAPIDocumentRefsResolve(t *testing.T) {
+	app, _ := newTestServer(t)
+
+	var document map[string]interface{}
+	err := json.Unmarshal(app.openAPI, &document)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	components := document["components"].(map[string]interface{})
+
+	var check func(v interface{})
+	check = func(v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			if ref, ok := v["$ref"].(string); ok {
+				parts := strings.Split(strings.TrimPrefix(ref, "#/components/"), "/")
+				if assert.Len(t, parts, 2, ref) {
+					kind, _ := components[parts[0]].(map[string]interface{})
+					assert.Contains(t, kind, parts[1], "unresolved %s", ref)
+				}
+			}
+			for _, child := range v {
+				check(child)
+			}
+		case []interface{}:
+			for _, child := range v {
+				check(child)
+			}
+		}
+	}
+
+	check(document)
+}
+
+// The schemas are maintained by hand, so the schemas of the representations
+// are checked against what the API actually sends.
+func TestOpenAPISchemasMatchResponses(t *testing.T) {
+	var document struct {
+		Components struct {
+			Schemas map[string]openAPISchema `json:"schemas"`
+		} `json:"components"`
+	}
+	err := json.Unmarshal(openAPIComponents, &document)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	schemas := document.Components.Schemas
+
+	deletedAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	full := &data.Hero{
+		ID:        1,
+		FirstSeen: time.Date(1938, 4, 18, 0, 0, 0, 0, time.UTC),
+		Name:      "Superman",
+		CanFly:    true,
+		RealName:  "Clark Kent",
+		Abilities: []string{"super strong", "flight"},
+		Version:   2,
+		DeletedAt: &deletedAt,
+	}
+	minimal := &data.Hero{ID: 2, Name: "Batman", Version: 1}
+
+	// Validation problems add errors to the Problem schema
+	for _, part := range schemas["ValidationProblem"].AllOf {
+		for name, property := range part.Properties {
+			schemas["Problem"].Properties[name] = property
+		}
+	}
+
+	for _, test := range []struct {
+		schema        string
+		full, minimal interface{}
+	}{
+		{schema: "Hero", full: full, minimal: minimal},
+		{schema: "HeroV2", full: newHeroV2(full), minimal: newHeroV2(minimal)},
+		{
+			schema: "Problem",
+			full: problem{
+				Type:      "about:blank",
+				Title:     "Unprocessable Entity",
+				Status:    http.StatusUnprocessableEntity,
+				Detail:    "the request contains invalid data",
+				Instance:  "/v1/heroes",
+				Errors:    map[string]string{"name": "must be provided"},
+				RequestID: "1",
+			},
+			minimal: problem{Type: "about:blank", Title: "Not Found", Status: http.StatusNotFound, Instance: "/v1/heroes/1"},
+		},
+	} {
+		t.Run(test.schema, func(t *testing.T) {
+			schema := schemas[test.schema]
+
+			fullMembers := marshalMembers(t, test.full)
+			for name := range schema.Properties {
+				assert.Contains(t, fullMembers, name, "%s is documented, but never sent", name)
+			}
+
+			for _, members := range []map[string]interface{}{fullMembers, marshalMembers(t, test.minimal)} {
+				for _, name := range schema.Required {
+					assert.Contains(t, members, name, "required %s is missing", name)
+				}
+
+				for name, value := range members {
+					property, ok := schema.Properties[name]
+					if assert.True(t, ok, "%s is sent, but not documented", name) {
+						assert.True(t, property.allows(value), "%s has type %T, but is documented as %s", name, value, property.Type)
+					}
+				}
+			}
+		})
+	}
+}
+
+// openAPISchema is the part of a schema object checked by the tests.
+type openAPISchema struct {
+	Type       json.RawMessage          `json:"type"`
+	Required   []string                 `json:"required"`
+	Properties map[string]openAPISchema `json:"properties"`
+	AllOf      []openAPISchema          `json:"allOf"`
+}
+
+// allows reports whether the type of the schema admits value, a value decoded
+// by encoding/json.
+func (s openAPISchema) allows(value interface{}) bool {
+	if s.Type == nil {
+		return true
+	}
+
+	var types []string
+	if err := json.Unmarshal(s.Type, &types); err != nil {
+		types = make([]string, 1)
+		if err := json.Unmarshal(s.Type, &types[0]); err != nil {
+			return false
+		}
+	}
+
+	var actual string
+	switch value := value.(type) {
+	case nil:
+		actual = "null"
+	case bool:
+		actual = "boolean"
+	case float64:
+		actual = "number"
+		if value == float64(int64(value)) {
+			actual = "integer"
+		}
+	case string:
+		actual = "string"
+	case []interface{}:
+		actual = "array"
+	case map[string]interface{}:
+		actual = "object"
+	}
+
+	for _, t := range types {
+		if t == actual || (t == "number" && actual == "integer") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// marshalMembers returns the members of the JSON representation of v.
+func marshalMembers(t *testing.T, v interface{}) map[string]interface{} {
+	js, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var members map[string]interface{}
+	err = json.Unmarshal(js, &members)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return members
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"heroes.rainerstropek.com/internal/data"
+)
+
+// apiVersion is the version of the API a route belongs to. All versions are
+// served by the same handlers and the same HeroesRepository, they only differ
+// in the representation of heroes. Handlers therefore never write heroes
+// directly, but shape them with heroResponse and heroesResponse.
+type apiVersion int
+
+const (
+	// Abilities are a comma-separated string (see data.Hero.MarshalJSON)
+	apiV1 apiVersion = 1
+
+	// Abilities are an array, like in requests
+	apiV2 apiVersion = 2
+)
+
+func (v apiVersion) prefix() string {
+	return fmt.Sprintf("/v%d", v)
+}
+
+// withAPIVersion marks the requests of a route as belonging to version.
+func withAPIVersion(version apiVersion, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		next(w, contextWithAPIVersion(r, version))
+	}
+}
+
+// heroV2 is the representation of a hero in /v2.
+type heroV2 struct {
+	ID        int64      `json:"id"`
+	FirstSeen time.Time  `json:"firstSeen"`
+	Name      string     `json:"name"`
+	CanFly    bool       `json:"canFly"`
+	RealName  string     `json:"realName,omitempty"`
+	Abilities []string   `json:"abilities"`
+	Version   int32      `json:"version"`
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
+}
+
+func newHeroV2(hero *data.Hero) heroV2 {
+	abilities := hero.Abilities
+	if abilities == nil {
+		abilities = []string{}
+	}
+
+	return heroV2{
+		ID:        hero.ID,
+		FirstSeen: hero.FirstSeen,
+		Name:      hero.Name,
+		CanFly:    hero.CanFly,
+		RealName:  hero.RealName,
+		Abilities: abilities,
+		Version:   hero.Version,
+		DeletedAt: hero.DeletedAt,
+	}
+}
+
+// heroResponse returns the representation of a hero in the API version of
+// the request.
+func heroResponse(r *http.Request, hero *data.Hero) interface{} {
+	switch apiVersionOf(r) {
+	case apiV2:
+		return newHeroV2(hero)
+	default:
+		return hero
+	}
+}
+
+// heroesResponse returns the representation of heroes in the API version of
+// the request.
+func heroesResponse(r *http.Request, heroes []*data.Hero) interface{} {
+	switch apiVersionOf(r) {
+	case apiV2:
+		result := make([]heroV2, len(heroes))
+		for i, hero := range heroes {
+			result[i] = newHeroV2(hero)
+		}
+		return result
+	default:
+		return heroes
+	}
+}
+
+// heroLocation returns the URL of a hero in the API version of the request.
+func heroLocation(r *http.Request, hero *data.Hero) string {
+	return fmt.Sprintf("%s/heroes/%d", apiVersionOf(r).prefix(), hero.ID)
+}
+
+// heroInput is the body of requests creating or replacing a hero.
+type heroInput struct {
+	Name      string    `json:"name"`
+	FirstSeen time.Time `json:"firstSeen"`
+	CanFly    bool      `json:"canFly"`
+	RealName  string    `json:"realName,omitempty"`
+	Abilities []string  `json:"abilities"`
+}
+
+// heroPatch is the body of JSON merge patch requests. The members are kept
+// raw to tell members that are missing in the patch (left untouched) apart
+// from members that are null (removed, see mergeMember).
+type heroPatch struct {
+	Name      json.RawMessage `json:"name"`
+	FirstSeen json.RawMessage `json:"firstSeen"`
+	CanFly    json.RawMessage `json:"canFly"`
+	RealName  json.RawMessage `json:"realName"`
+	Abilities json.RawMessage `json:"abilities"`
+}
+
+// apply merges the patch into hero. Removing required fields makes the hero
+// invalid, so it must be validated afterwards.
+func (p heroPatch) apply(hero *data.Hero) error {
+	if err := mergeMember("name", p.Name, &hero.Name); err != nil {
+		return err
+	}
+	if err := mergeMember("firstSeen", p.FirstSeen, &hero.FirstSeen); err != nil {
+		return err
+	}
+	if err := mergeMember("canFly", p.CanFly, &hero.CanFly); err != nil {
+		return err
+	}
+	if err := mergeMember("realName", p.RealName, &hero.RealName); err != nil {
+		return err
+	}
+
+	// Merge patch replaces arrays as a whole
+	return mergeMember("abilities", p.Abilities, &hero.Abilities)
+}
+
+// mergeMember merges a member of a JSON merge patch into dst. Missing members
+// leave dst untouched. null removes the member, which resets dst to its zero
+// value.
+func mergeMember[T any](name string, member json.RawMessage, dst *T) error {
+	if member == nil {
+		return nil
+	}
+
+	var value *T
+	err := json.Unmarshal(member, &value)
+	if err != nil {
+		var unmarshalTypeError *json.UnmarshalTypeError
+		if errors.As(err, &unmarshalTypeError) {
+			return fmt.Errorf("body contains incorrect JSON type for field %q", name)
+		}
+		return err
+	}
+
+	if value == nil {
+		var zero T
+		*dst = zero
+		return nil
+	}
+
+	*dst = *value
+	return nil
+}
+
+// readOnlyHeroFields are the fields of heroV2 that clients cannot change.
+type readOnlyHeroFields struct {
+	ID        json.RawMessage `json:"id"`
+	Version   json.RawMessage `json:"version"`
+	DeletedAt json.RawMessage `json:"deletedAt"`
+}
+
+// readHeroJSON reads a heroInput or heroPatch from the request body. /v2
+// accepts heroes in the representation it returns, so the read-only fields
+// of responses are ignored. /v1 rejects them as unknown keys.
+func (app *application) readHeroJSON(w http.ResponseWriter, r *http.Request, dst interface{}) error {
+	if apiVersionOf(r) == apiV1 {
+		return app.readJSON(w, r, dst)
+	}
+
+	switch dst := dst.(type) {
+	case *heroInput:
+		return app.readJSON(w, r, &struct {
+			*heroInput
+			readOnlyHeroFields
+		}{heroInput: dst})
+	case *heroPatch:
+		return app.readJSON(w, r, &struct {
+			*heroPatch
+			readOnlyHeroFields
+		}{heroPatch: dst})
+	default:
+		panic(fmt.Sprintf("readHeroJSON: unsupported type %T", dst))
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeroRepresentations(t *testing.T) {
+	_, ts := newTestServer(t)
+	token := mintTestToken(t, "Heroes.Read Heroes.Write")
+
+	rs := doRequest(t, ts, http.MethodPost, "/v2/heroes", token,
+		`{"name": "Superman", "firstSeen": "1938-04-18T00:00:00Z", "canFly": true, "abilities": ["super strong", "flight"]}`)
+	assert.Equal(t, http.StatusCreated, rs.StatusCode)
+	assert.Equal(t, "/v2/heroes/1", rs.Header.Get("Location"))
+
+	var created struct {
+		Abilities []string `json:"abilities"`
+	}
+	err := json.NewDecoder(rs.Body).Decode(&created)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, []string{"super strong", "flight"}, created.Abilities)
+
+	// Both versions serve the same heroes
+	rs = doRequest(t, ts, http.MethodGet, "/v1/heroes/1", token, "")
+	assert.Equal(t, http.StatusOK, rs.StatusCode)
+
+	v1, err := io.ReadAll(rs.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Contains(t, string(v1), `"abilities":"super strong, flight"`)
+
+	// A v1 hero cannot be sent back, abilities must be an array
+	rs = doRequest(t, ts, http.MethodPut, "/v1/heroes/1", token, string(v1))
+	assert.Equal(t, http.StatusBadRequest, rs.StatusCode)
+
+	// A v2 hero can, its read-only fields are ignored
+	rs = doRequest(t, ts, http.MethodGet, "/v2/heroes/1", token, "")
+	assert.Equal(t, http.StatusOK, rs.StatusCode)
+
+	v2, err := io.ReadAll(rs.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Contains(t, string(v2), `"abilities":["super strong","flight"]`)
+
+	rs = doRequest(t, ts, http.MethodPut, "/v2/heroes/1", token, string(v2), "If-Match", rs.Header.Get("ETag"))
+	assert.Equal(t, http.StatusOK, rs.StatusCode)
+	assert.Equal(t, `"2"`, rs.Header.Get("ETag"))
+
+	rs = doRequest(t, ts, http.MethodPatch, "/v2/heroes/1", token, `{"id": 1, "realName": "Clark Kent"}`)
+	assert.Equal(t, http.StatusOK, rs.StatusCode)
+
+	rs = doRequest(t, ts, http.MethodPatch, "/v1/heroes/1", token, `{"id": 1, "realName": "Kal-El"}`)
+	assert.Equal(t, http.StatusBadRequest, rs.StatusCode)
+
+	rs = doRequest(t, ts, http.MethodGet, "/v2/heroes", token, "")
+	assert.Equal(t, http.StatusOK, rs.StatusCode)
+
+	var list struct {
+		Heroes []struct {
+			RealName  string   `json:"realName"`
+			Abilities []string `json:"abilities"`
+		} `json:"heroes"`
+	}
+	err = json.NewDecoder(rs.Body).Decode(&list)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if assert.Len(t, list.Heroes, 1) {
+		assert.Equal(t, "Clark Kent", list.Heroes[0].RealName)
+		assert.Equal(t, []string{"super strong", "flight"}, list.Heroes[0].Abilities)
+	}
+
+	// Exports use the representation of their version, so they can be imported
+	rs = doRequest(t, ts, http.MethodGet, "/v2/heroes:export", token, "")
+	assert.Equal(t, http.StatusOK, rs.StatusCode)
+
+	scanner := bufio.NewScanner(rs.Body)
+	if assert.True(t, scanner.Scan()) {
+		assert.Contains(t, scanner.Text(), `"abilities":["super strong","flight"]`)
+	}
+}
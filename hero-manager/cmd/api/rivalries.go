@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"heroes.rainerstropek.com/internal/data"
+	"heroes.rainerstropek.com/internal/validator"
+)
+
+// heroRivalsHandler lists the rivals of a hero sorted by name.
+func (app *application) heroRivalsHandler(w http.ResponseWriter, r *http.Request) {
+	hero := app.readHero(w, r)
+	if hero == nil {
+		return
+	}
+
+	rivals, err := app.models.Heroes.Rivals(r.Context(), hero.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeListJSON(w, r, envelope{"heroes": heroesResponse(r, rivals)}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readRivalry reads the heroes of /v1/heroes/:id/rivals/:rivalId. If they
+// cannot be read, the error response has already been sent and ok is false.
+func (app *application) readRivalry(w http.ResponseWriter, r *http.Request) (heroID, rivalID int64, ok bool) {
+	heroID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return 0, 0, false
+	}
+
+	rivalID, err = app.readIDParamByName(r, "rivalId")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return 0, 0, false
+	}
+
+	v := validator.New()
+
+	if data.ValidateRivalry(v, heroID, rivalID); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return 0, 0, false
+	}
+
+	return heroID, rivalID, true
+}
+
+// addHeroRivalHandler makes two heroes rivals of each other. Adding a
+// rivalry again has no effect.
+func (app *application) addHeroRivalHandler(w http.ResponseWriter, r *http.Request) {
+	heroID, rivalID, ok := app.readRivalry(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.models.Heroes.AddRival(r.Context(), heroID, rivalID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, "successfully added", nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) removeHeroRivalHandler(w http.ResponseWriter, r *http.Request) {
+	heroID, rivalID, ok := app.readRivalry(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.models.Heroes.RemoveRival(r.Context(), heroID, rivalID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, "successfully removed", nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"net/http"
 
 	"heroes.rainerstropek.com/internal/middleware"
@@ -9,31 +10,189 @@ import (
 	"github.com/justinas/alice"
 )
 
-func (app *application) routes() http.Handler {
+// routes returns the handler of the API. Background work of the handler
+// (e.g. evicting idle clients of the rate limit) stops when ctx is done.
+func (app *application) routes(ctx context.Context) http.Handler {
+	metrics := app.newMetrics()
+
+	app.registered = nil
+	app.limiter = newRateLimiter(ctx)
+
+	// Anonymous routes are limited per IP address, protected ones per JWT
+	// subject. Probes of load balancers are not limited, a 429 would take
+	// the instance out of rotation.
+	perIP := func(next http.HandlerFunc) http.HandlerFunc {
+		return app.rateLimitPerIP(next).ServeHTTP
+	}
+
 	router := httprouter.New()
-	router.MethodNotAllowed = http.HandlerFunc(app.methodNotAllowedResponse)
-	router.HandlerFunc(http.MethodGet, "/v1/healthcheck", app.healthcheckHandler)
+	router.MethodNotAllowed = perIP(app.methodNotAllowedResponse)
+	app.handlePublic(router, http.MethodGet, "/v1/healthcheck", perIP(app.healthcheckHandler))
+	app.handlePublic(router, http.MethodGet, "/v1/healthz", app.healthcheckHandler)
+	app.handlePublic(router, http.MethodGet, "/v1/readyz", app.readinessHandler)
+	app.handlePublic(router, http.MethodGet, "/v1/openapi.json", perIP(app.openAPIHandler))
 
-	jwtMiddleware := middleware.NewJwtMiddleware(
-		app.config.azure.tenantId,
-		[]string{"api://4fac0887-b94f-4ea9-a8d3-06c7bca2a7bd"}) // Make scope configurable if you need to
+	// Every protected route declares the permission it requires
+	const (
+		read          = middleware.PermissionHeroesRead
+		write         = middleware.PermissionHeroesWrite
+		admin         = middleware.PermissionAdmin
+		authenticated = "" // any validated JWT
+	)
 
 	protectedrouter := httprouter.New()
 	protectedrouter.NotFound = http.HandlerFunc(app.notFoundResponse)
 	protectedrouter.MethodNotAllowed = http.HandlerFunc(app.methodNotAllowedResponse)
-	protectedrouter.HandlerFunc(http.MethodGet, "/v1/heroes", app.listHeroesHandler)
-	protectedrouter.HandlerFunc(http.MethodPost, "/v1/heroes", app.createHeroHandler)
-	protectedrouter.HandlerFunc(http.MethodPut, "/v1/heroes/:id", app.updateHeroHandler)
-	protectedrouter.HandlerFunc(http.MethodDelete, "/v1/heroes/:id", app.deleteHeroHandler)
-	protectedrouter.HandlerFunc(http.MethodPost, "/v1/generate", app.generateDemoDataHandler)
-	protectedrouter.HandlerFunc(http.MethodGet, "/v1/heroes/:id", app.showHeroHandler)
-	protectedrouter.HandlerFunc(http.MethodGet, "/v1/claims", middleware.ClaimsHandler)
-	router.NotFound = jwtMiddleware.CheckJWT(protectedrouter)
-
-	c := alice.New()
-	c.Append(app.recoverPanic)
-	c.Append(app.enableCORS)
+
+	// Heroes are served by /v1 and /v2, which only differ in the
+	// representation of heroes
+	var heroMethods []customMethodRoute
+	for _, version := range []apiVersion{apiV1, apiV2} {
+		v := func(next http.HandlerFunc) http.HandlerFunc {
+			return withAPIVersion(version, next)
+		}
+
+		heroes := version.prefix() + "/heroes"
+		app.handle(protectedrouter, http.MethodGet, heroes, read, v(app.listHeroesHandler))
+		app.handle(protectedrouter, http.MethodPost, heroes, write, v(app.idempotent(app.createHeroHandler)))
+		app.handle(protectedrouter, http.MethodPut, heroes+"/:id", write, v(app.updateHeroHandler))
+		app.handle(protectedrouter, http.MethodPatch, heroes+"/:id", write, v(app.patchHeroHandler))
+		app.handle(protectedrouter, http.MethodDelete, heroes+"/:id", admin, v(app.deleteHeroHandler))
+		app.handle(protectedrouter, http.MethodPost, heroes+"/:id/restore", write, v(app.restoreHeroHandler))
+		app.handle(protectedrouter, http.MethodPost, heroes+"/:id/purge", admin, v(app.purgeHeroHandler))
+		app.handle(protectedrouter, http.MethodGet, heroes+"/:id", read, v(app.showHeroHandler))
+		app.handle(protectedrouter, http.MethodGet, heroes+"/:id/history", read, v(app.heroHistoryHandler))
+		app.handle(protectedrouter, http.MethodGet, heroes+"/:id/teams", read, v(app.heroTeamsHandler))
+		app.handle(protectedrouter, http.MethodGet, heroes+"/:id/rivals", read, v(app.heroRivalsHandler))
+		app.handle(protectedrouter, http.MethodPut, heroes+"/:id/rivals/:rivalId", write, v(app.addHeroRivalHandler))
+		app.handle(protectedrouter, http.MethodDelete, heroes+"/:id/rivals/:rivalId", write, v(app.removeHeroRivalHandler))
+
+		heroMethods = append(heroMethods,
+			customMethodRoute{http.MethodPost, heroes + ":import", write, v(app.importHeroesHandler)},
+			customMethodRoute{http.MethodGet, heroes + ":export", read, v(app.exportHeroesHandler)},
+		)
+	}
+
+	app.handle(protectedrouter, http.MethodPost, "/v1/generate", admin, app.generateDemoDataHandler)
+	app.handle(protectedrouter, http.MethodGet, "/v1/teams", read, app.listTeamsHandler)
+	app.handle(protectedrouter, http.MethodPost, "/v1/teams", write, app.createTeamHandler)
+	app.handle(protectedrouter, http.MethodGet, "/v1/teams/:id", read, app.showTeamHandler)
+	app.handle(protectedrouter, http.MethodPut, "/v1/teams/:id", write, app.updateTeamHandler)
+	app.handle(protectedrouter, http.MethodDelete, "/v1/teams/:id", admin, app.deleteTeamHandler)
+	app.handle(protectedrouter, http.MethodGet, "/v1/teams/:id/members", read, app.teamMembersHandler)
+	app.handle(protectedrouter, http.MethodPut, "/v1/teams/:id/members/:heroId", write, app.addTeamMemberHandler)
+	app.handle(protectedrouter, http.MethodDelete, "/v1/teams/:id/members/:heroId", write, app.removeTeamMemberHandler)
+	app.handle(protectedrouter, http.MethodGet, "/v1/claims", authenticated, app.showClaimsHandler)
+
+	customMethods := app.customMethods(protectedrouter, heroMethods...)
+	router.NotFound = app.authenticate(app.rateLimitPerSubject(customMethods))
+
+	c := alice.New(app.logRequests, metrics.middleware, app.compress, app.recoverPanic, app.enableCORS)
 	chain := c.Then(router)
 
-	return chain
+	// Scrapes are served outside of the chain, so that they are neither
+	// rate limited nor counted in the metrics they return
+	app.registered = append(app.registered, route{method: http.MethodGet, pattern: "/metrics", public: true})
+	scrape := app.recoverPanic(metrics.handler())
+
+	// A route without an entry in apiOperations is a programming error
+	openAPI, err := app.openAPIDocument()
+	if err != nil {
+		panic(err)
+	}
+	app.openAPI = openAPI
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/metrics" {
+			chain.ServeHTTP(w, r)
+			return
+		}
+
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			app.methodNotAllowedResponse(w, r)
+			return
+		}
+
+		scrape.ServeHTTP(w, r)
+	})
+}
+
+// route is a registered route. The paths of the OpenAPI document are
+// generated from them.
+type route struct {
+	method     string
+	pattern    string
+	public     bool   // served without a JWT
+	permission string // required permission of protected routes
+}
+
+// handle registers a protected handler. It is only called if the validated
+// JWT of the request grants permission, any validated JWT will do if
+// permission is "". router must be behind the JWT middleware.
+func (app *application) handle(router *httprouter.Router, method, pattern, permission string, handler http.HandlerFunc) {
+	if permission != "" {
+		handler = app.requirePermission(permission, handler)
+	}
+
+	app.register(router, route{method: method, pattern: pattern, permission: permission}, handler)
+}
+
+// handlePublic registers a handler that is served without a JWT.
+func (app *application) handlePublic(router *httprouter.Router, method, pattern string, handler http.HandlerFunc) {
+	app.register(router, route{method: method, pattern: pattern, public: true}, handler)
+}
+
+// register records a route and the route pattern of matched requests (e.g.
+// for metrics).
+func (app *application) register(router *httprouter.Router, route route, handler http.HandlerFunc) {
+	app.registered = append(app.registered, route)
+	pattern := route.pattern
+	router.HandlerFunc(route.method, pattern, func(w http.ResponseWriter, r *http.Request) {
+		setRoutePattern(r, pattern)
+		handler(w, r)
+	})
+}
+
+type customMethodRoute struct {
+	method     string
+	pattern    string
+	permission string
+	handler    http.HandlerFunc
+}
+
+// customMethods serves routes with a custom method suffix (e.g.
+// /v1/heroes:import). httprouter cannot register them because it treats
+// the colon as the start of a parameter. Other requests are passed to next.
+func (app *application) customMethods(next http.Handler, routes ...customMethodRoute) http.Handler {
+	for i, r := range routes {
+		if r.permission != "" {
+			routes[i].handler = app.requirePermission(r.permission, r.handler)
+		}
+		app.registered = append(app.registered, route{method: r.method, pattern: r.pattern, permission: r.permission})
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pathMatched := false
+		for _, route := range routes {
+			if r.URL.Path != route.pattern {
+				continue
+			}
+
+			if r.Method == route.method {
+				setRoutePattern(r, route.pattern)
+				route.handler(w, r)
+				return
+			}
+
+			pathMatched = true
+		}
+
+		if pathMatched {
+			app.methodNotAllowedResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
 }
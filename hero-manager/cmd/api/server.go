@@ -10,18 +10,37 @@ import (
 	"os/signal"
 	"syscall"
 	"time"
+
+	"heroes.rainerstropek.com/internal/events"
 )
 
 func (app *application) serve() error {
+	// Stop background work of the handler once the server has stopped
+	handlerCtx, stopHandler := context.WithCancel(context.Background())
+	defer stopHandler()
+
 	srv := &http.Server{
 		Addr:         fmt.Sprintf(":%d", app.config.port),
-		Handler:      app.routes(),
+		Handler:      app.routes(handlerCtx),
 		ErrorLog:     log.New(app.logger, "", 0),
 		IdleTimeout:  time.Minute,
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 30 * time.Second,
 	}
 
+	// Publish hero events until the server has stopped
+	dispatcherCtx, stopDispatcher := context.WithCancel(context.Background())
+	dispatcherDone := make(chan struct{})
+	go func() {
+		events.NewDispatcher(app.models.Outbox, app.publisher, app.logger).Run(dispatcherCtx)
+		close(dispatcherDone)
+	}()
+
+	defer func() {
+		stopDispatcher()
+		<-dispatcherDone
+	}()
+
 	shutdownError := make(chan error)
 
 	go func() {
@@ -31,6 +50,11 @@ func (app *application) serve() error {
 
 		app.logger.Info().Str("signal", s.String()).Msg("shutting down server")
 
+		// Fail readiness checks first and keep serving for a while, so that
+		// load balancers stop sending requests before connections are refused
+		app.shuttingDown.Store(true)
+		time.Sleep(app.config.shutdownDelay)
+
 		// Give active requests a chance to finish
 		// See also https://github.com/golang/go/issues/33191
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
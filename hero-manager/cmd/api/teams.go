@@ -0,0 +1,325 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"heroes.rainerstropek.com/internal/data"
+	"heroes.rainerstropek.com/internal/validator"
+)
+
+func (app *application) createTeamHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	team := &data.Team{
+		Name:        input.Name,
+		Description: input.Description,
+	}
+
+	v := validator.New()
+
+	if data.ValidateTeam(v, team); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Teams.Insert(r.Context(), team)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/teams/%d", team.ID))
+	headers.Set("ETag", app.teamETag(team))
+
+	err = app.writeJSON(w, http.StatusCreated, team, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readTeam returns the team of the id route parameter. If it cannot be read,
+// the error response has already been sent and nil is returned.
+func (app *application) readTeam(w http.ResponseWriter, r *http.Request) *data.Team {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil
+	}
+
+	team, err := app.models.Teams.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil
+	}
+
+	return team
+}
+
+func (app *application) showTeamHandler(w http.ResponseWriter, r *http.Request) {
+	team := app.readTeam(w, r)
+	if team == nil {
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", app.teamETag(team))
+
+	if app.ifNoneMatch(r, headers.Get("ETag")) {
+		app.notModifiedResponse(w, headers)
+		return
+	}
+
+	err := app.writeJSON(w, http.StatusOK, team, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateTeamHandler(w http.ResponseWriter, r *http.Request) {
+	team := app.readTeam(w, r)
+	if team == nil {
+		return
+	}
+
+	if !app.ifMatch(r, app.teamETag(team)) {
+		app.preconditionFailedResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	team.Name = input.Name
+	team.Description = input.Description
+
+	v := validator.New()
+
+	if data.ValidateTeam(v, team); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Teams.Update(r.Context(), team)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", app.teamETag(team))
+
+	err = app.writeJSON(w, http.StatusOK, team, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteTeamHandler permanently deletes a team. Its members are not deleted.
+func (app *application) deleteTeamHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Teams.Delete(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, "successfully deleted", nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listTeamsHandler(w http.ResponseWriter, r *http.Request) {
+	var filters data.Filters
+
+	v := validator.New()
+	qs := r.URL.Query()
+	filters.Page = app.readInt(qs, "page", 1, v)
+	filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	filters.Sort = app.readString(qs, "sort", "id")
+	filters.SortSafelist = []string{"id", "name"}
+
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	teams, metadata, err := app.models.Teams.GetAll(r.Context(), filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	if links := app.paginationLinks(r, metadata); links != "" {
+		headers.Set("Link", links)
+	}
+
+	err = app.writeListJSON(w, r, envelope{"metadata": metadata, "teams": teams}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// teamMembersHandler lists the heroes of a team sorted by name.
+func (app *application) teamMembersHandler(w http.ResponseWriter, r *http.Request) {
+	team := app.readTeam(w, r)
+	if team == nil {
+		return
+	}
+
+	heroes, err := app.models.Teams.Members(r.Context(), team.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeListJSON(w, r, envelope{"heroes": heroesResponse(r, heroes)}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// addTeamMemberHandler adds a hero to a team. Adding a member again has no
+// effect.
+func (app *application) addTeamMemberHandler(w http.ResponseWriter, r *http.Request) {
+	teamID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	heroID, err := app.readIDParamByName(r, "heroId")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Teams.AddMember(r.Context(), teamID, heroID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, "successfully added", nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) removeTeamMemberHandler(w http.ResponseWriter, r *http.Request) {
+	teamID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	heroID, err := app.readIDParamByName(r, "heroId")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Teams.RemoveMember(r.Context(), teamID, heroID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, "successfully removed", nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readHero returns the hero of the id route parameter. If it cannot be read,
+// the error response has already been sent and nil is returned.
+func (app *application) readHero(w http.ResponseWriter, r *http.Request) *data.Hero {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil
+	}
+
+	hero, err := app.models.Heroes.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil
+	}
+
+	return hero
+}
+
+// heroTeamsHandler lists the teams of a hero sorted by name.
+func (app *application) heroTeamsHandler(w http.ResponseWriter, r *http.Request) {
+	hero := app.readHero(w, r)
+	if hero == nil {
+		return
+	}
+
+	teams, err := app.models.Teams.TeamsOf(r.Context(), hero.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeListJSON(w, r, envelope{"teams": teams}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
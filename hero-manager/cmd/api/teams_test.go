@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func decodeNames(t *testing.T, rs *http.Response, key string) []string {
+	var result map[string]json.RawMessage
+	err := json.NewDecoder(rs.Body).Decode(&result)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var items []struct {
+		Name string `json:"name"`
+	}
+	err = json.Unmarshal(result[key], &items)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{}
+	for _, item := range items {
+		names = append(names, item.Name)
+	}
+
+	return names
+}
+
+func TestTeamsEndToEnd(t *testing.T) {
+	_, ts := newTestServer(t)
+	token := mintTestToken(t, "Heroes.Read Heroes.Write", "Admin")
+
+	for _, name := range []string{"Superman", "Batman", "Lex Luthor"} {
+		rs := doRequest(t, ts, http.MethodPost, "/v1/heroes", token, `{"name": "`+name+`", "abilities": ["x"]}`)
+		assert.Equal(t, http.StatusCreated, rs.StatusCode)
+	}
+
+	rs := doRequest(t, ts, http.MethodPost, "/v1/teams", token, `{"name": "Justice League", "description": "Founded in 1960"}`)
+	assert.Equal(t, http.StatusCreated, rs.StatusCode)
+	assert.Equal(t, "/v1/teams/1", rs.Header.Get("Location"))
+
+	rs = doRequest(t, ts, http.MethodPost, "/v1/teams", token, `{"name": ""}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, rs.StatusCode)
+
+	rs = doRequest(t, ts, http.MethodPut, "/v1/teams/1", token, `{"name": "JLA"}`, "If-Match", `"1"`)
+	assert.Equal(t, http.StatusOK, rs.StatusCode)
+	assert.Equal(t, `"2"`, rs.Header.Get("ETag"))
+
+	rs = doRequest(t, ts, http.MethodPut, "/v1/teams/1", token, `{"name": "Justice League"}`, "If-Match", `"1"`)
+	assert.Equal(t, http.StatusPreconditionFailed, rs.StatusCode)
+
+	for _, heroID := range []string{"1", "2"} {
+		rs = doRequest(t, ts, http.MethodPut, "/v1/teams/1/members/"+heroID, token, "")
+		assert.Equal(t, http.StatusOK, rs.StatusCode)
+	}
+
+	rs = doRequest(t, ts, http.MethodPut, "/v1/teams/1/members/42", token, "")
+	assert.Equal(t, http.StatusNotFound, rs.StatusCode)
+
+	rs = doRequest(t, ts, http.MethodGet, "/v1/teams/1/members", token, "")
+	assert.Equal(t, []string{"Batman", "Superman"}, decodeNames(t, rs, "heroes"))
+
+	rs = doRequest(t, ts, http.MethodGet, "/v1/heroes/1/teams", token, "")
+	assert.Equal(t, []string{"JLA"}, decodeNames(t, rs, "teams"))
+
+	rs = doRequest(t, ts, http.MethodPut, "/v1/heroes/1/rivals/3", token, "")
+	assert.Equal(t, http.StatusOK, rs.StatusCode)
+
+	rs = doRequest(t, ts, http.MethodPut, "/v1/heroes/1/rivals/1", token, "")
+	assert.Equal(t, http.StatusUnprocessableEntity, rs.StatusCode)
+
+	rs = doRequest(t, ts, http.MethodGet, "/v1/heroes/3/rivals", token, "")
+	assert.Equal(t, []string{"Superman"}, decodeNames(t, rs, "heroes"))
+
+	// Deleted heroes leave their teams and rivalries
+	rs = doRequest(t, ts, http.MethodDelete, "/v1/heroes/1", token, "")
+	assert.Equal(t, http.StatusOK, rs.StatusCode)
+
+	rs = doRequest(t, ts, http.MethodGet, "/v1/teams/1/members", token, "")
+	assert.Equal(t, []string{"Batman"}, decodeNames(t, rs, "heroes"))
+
+	rs = doRequest(t, ts, http.MethodGet, "/v1/heroes/3/rivals", token, "")
+	assert.Empty(t, decodeNames(t, rs, "heroes"))
+
+	rs = doRequest(t, ts, http.MethodGet, "/v1/heroes/1/teams", token, "")
+	assert.Equal(t, http.StatusNotFound, rs.StatusCode)
+
+	rs = doRequest(t, ts, http.MethodDelete, "/v1/teams/1/members/2", token, "")
+	assert.Equal(t, http.StatusOK, rs.StatusCode)
+
+	rs = doRequest(t, ts, http.MethodDelete, "/v1/teams/1", token, "")
+	assert.Equal(t, http.StatusOK, rs.StatusCode)
+
+	rs = doRequest(t, ts, http.MethodGet, "/v1/teams", token, "")
+	assert.Empty(t, decodeNames(t, rs, "teams"))
+}
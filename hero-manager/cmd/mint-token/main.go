@@ -0,0 +1,35 @@
+// Command mint-token prints a bearer token signed with the test fixture key.
+// Start the API with the following flags to accept it:
+//
+//	go run ./cmd/api -jwt-issuer=https://heroes.test/ -jwt-audiences=api://heroes-test -jwt-jwks-file=internal/jwttest/testdata/jwks.json
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"heroes.rainerstropek.com/internal/jwttest"
+	"heroes.rainerstropek.com/internal/middleware"
+)
+
+func main() {
+	subject := flag.String("sub", "local-developer", "Subject of the token")
+	scope := flag.String("scp", "Heroes.Read Heroes.Write", "Space-separated scopes")
+	roles := flag.String("roles", "", "Comma-separated roles (e.g. Admin)")
+	flag.Parse()
+
+	claims := middleware.CustomClaimsExample{Name: *subject, Scope: *scope}
+	if *roles != "" {
+		claims.Roles = strings.Split(*roles, ",")
+	}
+
+	token, err := jwttest.Mint(*subject, claims)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	fmt.Println(token)
+}
@@ -0,0 +1,123 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"reflect"
+	"time"
+)
+
+const (
+	AuditActionCreate  = "create"
+	AuditActionUpdate  = "update"
+	AuditActionDelete  = "delete"
+	AuditActionRestore = "restore"
+	AuditActionPurge   = "purge"
+)
+
+// AuditEvent records who changed a hero, when and what.
+type AuditEvent struct {
+	ID        int64                  `json:"id"`
+	HeroID    int64                  `json:"heroId"`
+	Action    string                 `json:"action"`
+	Actor     string                 `json:"actor"`
+	Version   int32                  `json:"version"`
+	Changes   map[string]FieldChange `json:"changes"`
+	CreatedAt time.Time              `json:"createdAt"`
+}
+
+// FieldChange contains the old and new value of a changed field. Old is nil
+// for created and New is nil for deleted heroes.
+type FieldChange struct {
+	Old interface{} `json:"old"`
+	New interface{} `json:"new"`
+}
+
+type actorContextKey struct{}
+
+// ContextWithActor returns a context carrying the identity (e.g. the JWT
+// subject) of whoever modifies heroes. It is recorded in audit events.
+func ContextWithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorContextKey{}, actor)
+}
+
+func actorFromContext(ctx context.Context) string {
+	actor, _ := ctx.Value(actorContextKey{}).(string)
+	return actor
+}
+
+// heroFields returns the auditable fields of a hero by their JSON name.
+// deletedAt is only present for soft deleted heroes.
+func heroFields(hero *Hero) map[string]interface{} {
+	if hero == nil {
+		return map[string]interface{}{}
+	}
+
+	fields := map[string]interface{}{
+		"name":      hero.Name,
+		"firstSeen": hero.FirstSeen,
+		"canFly":    hero.CanFly,
+		"realName":  hero.RealName,
+		"abilities": hero.Abilities,
+	}
+
+	if hero.DeletedAt != nil {
+		fields["deletedAt"] = *hero.DeletedAt
+	}
+
+	return fields
+}
+
+// heroDiff returns all fields that differ between old and new. Pass nil for
+// old when a hero is created and nil for new when it is purged.
+func heroDiff(old, new *Hero) map[string]FieldChange {
+	oldFields, newFields := heroFields(old), heroFields(new)
+
+	changes := make(map[string]FieldChange)
+	for _, name := range []string{"name", "firstSeen", "canFly", "realName", "abilities", "deletedAt"} {
+		oldValue, oldOK := oldFields[name]
+		newValue, newOK := newFields[name]
+		if (!oldOK && !newOK) || (oldOK && newOK && reflect.DeepEqual(oldValue, newValue)) {
+			continue
+		}
+
+		changes[name] = FieldChange{Old: oldValue, New: newValue}
+	}
+
+	return changes
+}
+
+// newAuditEvent creates the audit event for changing old into new.
+func newAuditEvent(ctx context.Context, action string, old, new *Hero) *AuditEvent {
+	event := &AuditEvent{
+		Action:    action,
+		Actor:     actorFromContext(ctx),
+		Changes:   heroDiff(old, new),
+		CreatedAt: time.Now().UTC().Truncate(time.Second),
+	}
+
+	if new != nil {
+		event.HeroID, event.Version = new.ID, new.Version
+	} else {
+		event.HeroID, event.Version = old.ID, old.Version
+	}
+
+	return event
+}
+
+// writeAuditEvent stores the audit event within the transaction changing the hero.
+func writeAuditEvent(ctx context.Context, tx *sql.Tx, createdAt interface{}, event *AuditEvent) error {
+	changes, err := json.Marshal(event.Changes)
+	if err != nil {
+		return err
+	}
+
+	query := `
+        INSERT INTO audit_events (hero_id, action, actor, version, changes, created_at)
+        VALUES ($1, $2, $3, $4, $5, $6)
+        RETURNING id`
+
+	args := []interface{}{event.HeroID, event.Action, event.Actor, event.Version, string(changes), createdAt}
+	return tx.QueryRowContext(ctx, query, args...).Scan(&event.ID)
+}
@@ -0,0 +1,105 @@
+package data
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidCursor is returned if a cursor cannot be decoded or does not
+// belong to the requested sort order.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// cursor is the decoded form of the opaque cursor used for keyset pagination.
+// It contains the sort expression it has been created for and the values of
+// all sort keys (including the trailing id) of the last row of a page.
+type cursor struct {
+	Sort   string   `json:"s"`
+	Values []string `json:"v"`
+}
+
+func encodeCursor(c cursor) string {
+	js, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(js)
+}
+
+func decodeCursor(s string) (cursor, error) {
+	var c cursor
+
+	js, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+
+	err = json.Unmarshal(js, &c)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+
+	return c, nil
+}
+
+// cursor decodes the filters' cursor and verifies that it matches the sort keys.
+func (f Filters) cursor() (cursor, error) {
+	c, err := decodeCursor(f.Cursor)
+	if err != nil {
+		return c, err
+	}
+
+	if c.Sort != f.Sort || len(c.Values) != len(f.sortKeys()) {
+		return c, ErrInvalidCursor
+	}
+
+	return c, nil
+}
+
+// nextCursor creates the cursor pointing behind the row whose sort key values
+// are returned by value.
+func (f Filters) nextCursor(value func(column string) string) string {
+	c := cursor{Sort: f.Sort}
+	for _, key := range f.sortKeys() {
+		c.Values = append(c.Values, value(key.Column))
+	}
+
+	return encodeCursor(c)
+}
+
+// seekPredicate returns a SQL predicate selecting all rows after the cursor
+// in sort order together with its arguments. Placeholders are numbered
+// starting at firstPlaceholder. For "-name,id" the result looks like this:
+// (name < $5 OR (name = $5 AND id > $6))
+func (f Filters) seekPredicate(firstPlaceholder int) (string, []interface{}, error) {
+	c, err := f.cursor()
+	if err != nil {
+		return "", nil, err
+	}
+
+	keys := f.sortKeys()
+	args := []interface{}{}
+	predicate := ""
+	for i := len(keys) - 1; i >= 0; i-- {
+		op := ">"
+		if keys[i].Descending {
+			op = "<"
+		}
+
+		placeholder := fmt.Sprintf("$%d", firstPlaceholder+i)
+		if predicate == "" {
+			predicate = fmt.Sprintf("%s %s %s", keys[i].Column, op, placeholder)
+		} else {
+			predicate = fmt.Sprintf("(%s %s %s OR (%s = %s AND %s))",
+				keys[i].Column, op, placeholder, keys[i].Column, placeholder, predicate)
+		}
+	}
+
+	for _, value := range c.Values {
+		args = append(args, value)
+	}
+
+	if len(keys) == 1 {
+		predicate = "(" + predicate + ")"
+	}
+
+	return predicate, args, nil
+}
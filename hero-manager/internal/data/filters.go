@@ -1,10 +1,23 @@
 package data
 
-import "heroes.rainerstropek.com/internal/validator"
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"strings"
 
+	"heroes.rainerstropek.com/internal/validator"
+)
+
+// Filters contains paging and sorting options for list queries.
+// Sort is a comma-separated list of columns from SortSafelist. A leading
+// "-" sorts the column in descending order (e.g. "-name,realname").
+// If Cursor is set, keyset pagination is used and Page is ignored.
 type Filters struct {
 	Page         int
 	PageSize     int
+	Cursor       string
 	Sort         string
 	SortSafelist []string
 }
@@ -14,7 +27,78 @@ func ValidateFilters(v *validator.Validator, f Filters) {
 	v.Check(f.Page <= 10_000_000, "page", "must be a maximum of 10 million")
 	v.Check(f.PageSize > 0, "page_size", "must be greater than zero")
 	v.Check(f.PageSize <= 100, "page_size", "must be a maximum of 100")
-	v.Check(validator.In(f.Sort, f.SortSafelist...), "sort", "invalid sort value")
+
+	ValidateSort(v, f)
+
+	// The cursor can only be checked against a valid sort expression
+	if _, invalidSort := v.Errors["sort"]; f.Cursor != "" && !invalidSort {
+		_, err := f.cursor()
+		v.Check(err == nil, "cursor", "must be a cursor returned for the same sort order")
+	}
+}
+
+// ValidateSort only validates the sort expression of f, e.g. for queries
+// that are not paged.
+func ValidateSort(v *validator.Validator, f Filters) {
+	seen := make(map[string]bool)
+	for _, key := range strings.Split(f.Sort, ",") {
+		column := strings.TrimPrefix(key, "-")
+		switch {
+		case !validator.In(column, f.SortSafelist...):
+			v.AddError("sort", fmt.Sprintf("invalid sort key %q", key))
+		case seen[column]:
+			v.AddError("sort", fmt.Sprintf("duplicate sort key %q", key))
+		}
+		seen[column] = true
+	}
+}
+
+// sortKey is a single column of a sort expression.
+type sortKey struct {
+	Column     string
+	Descending bool
+}
+
+func (k sortKey) direction() string {
+	if k.Descending {
+		return "DESC"
+	}
+
+	return "ASC"
+}
+
+// sortKeys parses Sort into its columns. It panics if a column is not in
+// SortSafelist. This should never happen as filters are validated before
+// they are used, but it is a last line of defense against SQL injection.
+func (f Filters) sortKeys() []sortKey {
+	keys := []sortKey{}
+	hasID := false
+	for _, key := range strings.Split(f.Sort, ",") {
+		column := strings.TrimPrefix(key, "-")
+		if !validator.In(column, f.SortSafelist...) {
+			panic("unsafe sort parameter: " + key)
+		}
+
+		keys = append(keys, sortKey{Column: column, Descending: strings.HasPrefix(key, "-")})
+		hasID = hasID || column == "id"
+	}
+
+	// Always sort by id last so that the order of rows is deterministic
+	if !hasID {
+		keys = append(keys, sortKey{Column: "id"})
+	}
+
+	return keys
+}
+
+// orderBy returns the ORDER BY expression for the filters' sort keys.
+func (f Filters) orderBy() string {
+	terms := []string{}
+	for _, key := range f.sortKeys() {
+		terms = append(terms, fmt.Sprintf("%s %s", key.Column, key.direction()))
+	}
+
+	return strings.Join(terms, ", ")
 }
 
 func (f Filters) limit() int {
@@ -24,3 +108,42 @@ func (f Filters) limit() int {
 func (f Filters) offset() int {
 	return (f.Page - 1) * f.PageSize
 }
+
+// Metadata describes the page of a list result. In keyset pagination mode,
+// only PageSize and NextCursor are set.
+type Metadata struct {
+	CurrentPage  int    `json:"current_page,omitempty"`
+	PageSize     int    `json:"page_size,omitempty"`
+	FirstPage    int    `json:"first_page,omitempty"`
+	LastPage     int    `json:"last_page,omitempty"`
+	TotalRecords int    `json:"total_records,omitempty"`
+	NextCursor   string `json:"next_cursor,omitempty"`
+}
+
+func calculateMetadata(totalRecords, page, pageSize int) Metadata {
+	if totalRecords == 0 {
+		return Metadata{}
+	}
+
+	return Metadata{
+		CurrentPage:  page,
+		PageSize:     pageSize,
+		FirstPage:    1,
+		LastPage:     int(math.Ceil(float64(totalRecords) / float64(pageSize))),
+		TotalRecords: totalRecords,
+	}
+}
+
+// pastLastPage reports whether an empty page may lie behind the last page
+// of a non-empty result. List queries take the total from count(*) OVER(),
+// which is not available without rows, so it has to be counted separately.
+func (f Filters) pastLastPage(rows int) bool {
+	return rows == 0 && f.Cursor == "" && f.offset() > 0
+}
+
+// countRows returns the number of rows of a query.
+func countRows(ctx context.Context, db *sql.DB, query string, args ...interface{}) (int, error) {
+	var count int
+	err := db.QueryRowContext(ctx, "SELECT count(*) FROM ("+query+") AS matches", args...).Scan(&count)
+	return count, contextError(ctx, err)
+}
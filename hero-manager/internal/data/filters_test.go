@@ -0,0 +1,67 @@
+package data
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"heroes.rainerstropek.com/internal/validator"
+)
+
+func newTestFilters(sort string) Filters {
+	return Filters{Page: 1, PageSize: 20, Sort: sort, SortSafelist: []string{"id", "name", "realname"}}
+}
+
+func TestValidateFiltersSort(t *testing.T) {
+	v := validator.New()
+	ValidateFilters(v, newTestFilters("-name,realname"))
+	assert.True(t, v.Valid())
+
+	v = validator.New()
+	ValidateFilters(v, newTestFilters("name,-abilities"))
+	assert.Equal(t, `invalid sort key "-abilities"`, v.Errors["sort"])
+
+	v = validator.New()
+	ValidateFilters(v, newTestFilters("name,-name"))
+	assert.Equal(t, `duplicate sort key "-name"`, v.Errors["sort"])
+
+	v = validator.New()
+	ValidateFilters(v, newTestFilters("name;DROP TABLE heroes"))
+	assert.False(t, v.Valid())
+}
+
+func TestOrderBy(t *testing.T) {
+	assert.Equal(t, "id ASC", newTestFilters("id").orderBy())
+	assert.Equal(t, "id DESC", newTestFilters("-id").orderBy())
+	assert.Equal(t, "name DESC, realname ASC, id ASC", newTestFilters("-name,realname").orderBy())
+	assert.Panics(t, func() { newTestFilters("name; DROP TABLE heroes").orderBy() })
+}
+
+func TestSeekPredicate(t *testing.T) {
+	f := newTestFilters("-name,realname")
+	hero := &Hero{ID: 42, Name: "Superman", RealName: "Clark Kent"}
+	f.Cursor = f.nextCursor(hero.sortValue)
+
+	predicate, args, err := f.seekPredicate(5)
+	assert.NoError(t, err)
+	assert.Equal(t, "(name < $5 OR (name = $5 AND (realname > $6 OR (realname = $6 AND id > $7))))", predicate)
+	assert.Equal(t, []interface{}{"Superman", "Clark Kent", "42"}, args)
+}
+
+func TestCursorMustMatchSort(t *testing.T) {
+	f := newTestFilters("name")
+	f.Cursor = f.nextCursor((&Hero{ID: 1, Name: "Superman"}).sortValue)
+
+	v := validator.New()
+	ValidateFilters(v, f)
+	assert.True(t, v.Valid())
+
+	f.Sort = "-name"
+	v = validator.New()
+	ValidateFilters(v, f)
+	assert.Contains(t, v.Errors, "cursor")
+
+	f.Cursor = "not-a-cursor"
+	v = validator.New()
+	ValidateFilters(v, f)
+	assert.Contains(t, v.Errors, "cursor")
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
@@ -14,13 +15,17 @@ import (
 )
 
 type Hero struct {
-	ID        int64     `json:"id"`
-	FirstSeen time.Time `json:"firstSeen"`
-	Name      string    `json:"name"`
-	CanFly    bool      `json:"canFly"`
-	RealName  string    `json:"realName,omitempty"`
-	Abilities []string  `json:"-"`
-	Version   int32     `json:"version"`
+	ID        int64      `json:"id"`
+	FirstSeen time.Time  `json:"firstSeen"`
+	Name      string     `json:"name"`
+	CanFly    bool       `json:"canFly"`
+	RealName  string     `json:"realName,omitempty"`
+	Abilities []string   `json:"-"`
+	Version   int32      `json:"version"`
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
+
+	// Sort value for search results, lower values are better matches
+	relevance float64
 }
 
 func (h Hero) MarshalJSON() ([]byte, error) {
@@ -43,6 +48,25 @@ func (h Hero) MarshalJSON() ([]byte, error) {
 	return json.Marshal(aux)
 }
 
+// sortValue returns the value of a sort column as it is stored in a cursor.
+func (h *Hero) sortValue(column string) string {
+	switch column {
+	case "id":
+		return strconv.FormatInt(h.ID, 10)
+	case "name":
+		return h.Name
+	case "realname":
+		return h.RealName
+	case "first_seen":
+		// PostgreSQL parses the format, SQLite stores it
+		return sqliteTime(h.FirstSeen)
+	case "relevance":
+		return strconv.FormatFloat(h.relevance, 'g', -1, 64)
+	default:
+		panic("unknown sort column: " + column)
+	}
+}
+
 func ValidateHero(v *validator.Validator, hero *Hero) {
 	v.Check(hero.Name != "", "name", "must be provided")
 	v.Check(len(hero.Name) <= 100, "name", "must not be more than 100 bytes long")
@@ -53,58 +77,177 @@ func ValidateHero(v *validator.Validator, hero *Hero) {
 	v.Check(validator.Unique(hero.Abilities), "abilities", "must not contain duplicate values")
 }
 
+// HeroFilter contains the criteria heroes are listed by.
+// Name is a case-insensitive LIKE pattern (empty matches all heroes),
+// Abilities must all be present. Q is a full-text search query, all of its
+// words must occur in the name, real name or abilities. FirstSeenFrom and
+// FirstSeenTo limit FirstSeen (inclusive, zero values are unbounded), CanFly
+// is ignored if nil. Soft deleted heroes are only included if IncludeDeleted
+// is set.
+//
+// When searching, heroes can be sorted by the pseudo column "relevance".
+// Ascending order lists the best matches first.
+type HeroFilter struct {
+	Name           string
+	Abilities      []string
+	Q              string
+	FirstSeenFrom  time.Time
+	FirstSeenTo    time.Time
+	CanFly         *bool
+	IncludeDeleted bool
+}
+
+func ValidateHeroFilter(v *validator.Validator, heroFilter HeroFilter, filters Filters) {
+	v.Check(len(heroFilter.Q) <= 200, "q", "must not be more than 200 bytes long")
+
+	from, to := heroFilter.FirstSeenFrom, heroFilter.FirstSeenTo
+	v.Check(from.IsZero() || to.IsZero() || !to.Before(from), "first_seen_to", "must not be before first_seen_from")
+
+	for _, key := range strings.Split(filters.Sort, ",") {
+		if strings.TrimPrefix(key, "-") == "relevance" {
+			v.Check(heroFilter.Q != "", "sort", "relevance requires a search query (q)")
+		}
+	}
+}
+
 type HeroModel struct {
-	DB *sql.DB
+	DB           *sql.DB
+	QueryTimeout time.Duration
 }
 
-func (m HeroModel) Insert(hero *Hero) error {
+// heroDest returns the scan destinations for the columns
+// id, first_seen, name, can_fly, realname, abilities, version, deleted_at.
+func heroDest(hero *Hero) []interface{} {
+	return []interface{}{
+		&hero.ID,
+		&hero.FirstSeen,
+		&hero.Name,
+		&hero.CanFly,
+		&hero.RealName,
+		pq.Array(&hero.Abilities),
+		&hero.Version,
+		&hero.DeletedAt,
+	}
+}
+
+// listDest returns the scan destinations for rows of listQuery.
+func listDest(totalRecords *int, hero *Hero) []interface{} {
+	dest := append([]interface{}{totalRecords}, heroDest(hero)...)
+	return append(dest, &hero.relevance)
+}
+
+// Insert stores a new hero and records the audit event in the same transaction.
+func (m HeroModel) Insert(ctx context.Context, hero *Hero) error {
+	return m.InsertMany(ctx, []*Hero{hero})
+}
+
+// InsertMany stores new heroes, their audit events and outbox events in a
+// single transaction. Either all heroes are stored or none.
+func (m HeroModel) InsertMany(ctx context.Context, heroes []*Hero) error {
+	ctx, cancel := withQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	defer tx.Rollback()
+
 	query := `
         INSERT INTO heroes (first_seen, name, can_fly, realname, abilities) 
         VALUES ($1, $2, $3, $4, $5)
         RETURNING id, version`
-	args := []interface{}{hero.FirstSeen, hero.Name, hero.CanFly, hero.RealName, pq.Array(hero.Abilities)}
-	return m.DB.QueryRow(query, args...).Scan(&hero.ID, &hero.Version)
+
+	for _, hero := range heroes {
+		args := []interface{}{hero.FirstSeen, hero.Name, hero.CanFly, hero.RealName, pq.Array(hero.Abilities)}
+		err = tx.QueryRowContext(ctx, query, args...).Scan(&hero.ID, &hero.Version)
+		if err != nil {
+			return contextError(ctx, err)
+		}
+
+		event := newAuditEvent(ctx, AuditActionCreate, nil, hero)
+		err = writeAuditEvent(ctx, tx, event.CreatedAt, event)
+		if err != nil {
+			return contextError(ctx, err)
+		}
+
+		err = writeOutboxEvent(ctx, tx, event.CreatedAt, event, hero)
+		if err != nil {
+			return contextError(ctx, err)
+		}
+	}
+
+	return contextError(ctx, tx.Commit())
 }
 
-func (m HeroModel) Get(id int64) (*Hero, error) {
+// Get returns a hero unless it does not exist or has been deleted.
+func (m HeroModel) Get(ctx context.Context, id int64) (*Hero, error) {
 	if id < 1 {
 		return nil, ErrRecordNotFound
 	}
 
+	ctx, cancel := withQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
 	query := `
-        SELECT id, first_seen, name, can_fly, realname, abilities, version
+        SELECT id, first_seen, name, can_fly, realname, abilities, version, deleted_at
         FROM heroes
-        WHERE id = $1`
+        WHERE id = $1 AND deleted_at IS NULL`
 
 	var hero Hero
 
-	err := m.DB.QueryRow(query, id).Scan(
-		&hero.ID,
-		&hero.FirstSeen,
-		&hero.Name,
-		&hero.CanFly,
-		&hero.RealName,
-		pq.Array(&hero.Abilities),
-		&hero.Version,
-	)
-
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(heroDest(&hero)...)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
 			return nil, ErrRecordNotFound
 		default:
-			return nil, err
+			return nil, contextError(ctx, err)
 		}
 	}
 
 	return &hero, nil
 }
 
-func (m HeroModel) Update(hero *Hero) error {
+// Update stores a changed hero and records the audit event in the same
+// transaction. The hero's version must match the stored version.
+func (m HeroModel) Update(ctx context.Context, hero *Hero) error {
+	ctx, cancel := withQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	defer tx.Rollback()
+
+	// Lock the row so that the audited old values are the ones being replaced.
+	// If no row matches, the hero has been updated or deleted since it was
+	// read (optimistic concurrency).
 	query := `
+        SELECT id, first_seen, name, can_fly, realname, abilities, version, deleted_at
+        FROM heroes
+        WHERE id = $1 AND version = $2 AND deleted_at IS NULL
+        FOR UPDATE`
+
+	var old Hero
+
+	err = tx.QueryRowContext(ctx, query, hero.ID, hero.Version).Scan(heroDest(&old)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return contextError(ctx, err)
+		}
+	}
+
+	query = `
         UPDATE heroes
         SET first_seen = $1, name = $2, can_fly = $3, realname = $4, abilities = $5, version = version + 1
-        WHERE id = $6
+        WHERE id = $6 AND version = $7
         RETURNING version`
 
 	args := []interface{}{
@@ -114,81 +257,442 @@ func (m HeroModel) Update(hero *Hero) error {
 		hero.RealName,
 		pq.Array(hero.Abilities),
 		hero.ID,
+		hero.Version,
+	}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&hero.Version)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	event := newAuditEvent(ctx, AuditActionUpdate, &old, hero)
+	err = writeAuditEvent(ctx, tx, event.CreatedAt, event)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	err = writeOutboxEvent(ctx, tx, event.CreatedAt, event, hero)
+	if err != nil {
+		return contextError(ctx, err)
 	}
 
-	return m.DB.QueryRow(query, args...).Scan(&hero.Version)
+	return contextError(ctx, tx.Commit())
 }
 
-func (m HeroModel) Delete(id int64) error {
+// Delete soft deletes a hero. It can be restored until it is purged.
+// Like every change, deleting increments the version.
+func (m HeroModel) Delete(ctx context.Context, id int64) error {
 	if id < 1 {
 		return ErrRecordNotFound
 	}
 
+	ctx, cancel := withQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	defer tx.Rollback()
+
 	query := `
-        DELETE FROM heroes
-        WHERE id = $1`
+        UPDATE heroes
+        SET deleted_at = NOW(), version = version + 1
+        WHERE id = $1 AND deleted_at IS NULL
+        RETURNING id, first_seen, name, can_fly, realname, abilities, version, deleted_at`
 
-	result, err := m.DB.Exec(query, id)
+	var hero Hero
+
+	err = tx.QueryRowContext(ctx, query, id).Scan(heroDest(&hero)...)
 	if err != nil {
-		return err
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return contextError(ctx, err)
+		}
+	}
+
+	// Only deleted_at and the version have changed
+	old := hero
+	old.DeletedAt = nil
+	old.Version--
+
+	err = deleteHeroRelations(ctx, tx, id)
+	if err != nil {
+		return contextError(ctx, err)
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	event := newAuditEvent(ctx, AuditActionDelete, &old, &hero)
+	err = writeAuditEvent(ctx, tx, event.CreatedAt, event)
 	if err != nil {
-		return err
+		return contextError(ctx, err)
+	}
+
+	err = writeOutboxEvent(ctx, tx, event.CreatedAt, event, &hero)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	return contextError(ctx, tx.Commit())
+}
+
+// Restore undoes the soft deletion of a hero and returns it.
+func (m HeroModel) Restore(ctx context.Context, id int64) (*Hero, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	ctx, cancel := withQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	defer tx.Rollback()
+
+	query := `
+        SELECT id, first_seen, name, can_fly, realname, abilities, version, deleted_at
+        FROM heroes
+        WHERE id = $1 AND deleted_at IS NOT NULL
+        FOR UPDATE`
+
+	var old Hero
+
+	err = tx.QueryRowContext(ctx, query, id).Scan(heroDest(&old)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, contextError(ctx, err)
+		}
+	}
+
+	hero := old
+	hero.DeletedAt = nil
+
+	query = `
+        UPDATE heroes
+        SET deleted_at = NULL, version = version + 1
+        WHERE id = $1
+        RETURNING version`
+
+	err = tx.QueryRowContext(ctx, query, id).Scan(&hero.Version)
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	event := newAuditEvent(ctx, AuditActionRestore, &old, &hero)
+	err = writeAuditEvent(ctx, tx, event.CreatedAt, event)
+	if err != nil {
+		return nil, contextError(ctx, err)
 	}
 
-	if rowsAffected == 0 {
+	err = writeOutboxEvent(ctx, tx, event.CreatedAt, event, &hero)
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	return &hero, nil
+}
+
+// Purge permanently deletes a hero, regardless of whether it has been soft
+// deleted. Its history is kept.
+func (m HeroModel) Purge(ctx context.Context, id int64) error {
+	if id < 1 {
 		return ErrRecordNotFound
 	}
 
-	return nil
+	ctx, cancel := withQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	defer tx.Rollback()
+
+	query := `
+        DELETE FROM heroes
+        WHERE id = $1
+        RETURNING id, first_seen, name, can_fly, realname, abilities, version, deleted_at`
+
+	var old Hero
+
+	err = tx.QueryRowContext(ctx, query, id).Scan(heroDest(&old)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return contextError(ctx, err)
+		}
+	}
+
+	err = deleteHeroRelations(ctx, tx, id)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	event := newAuditEvent(ctx, AuditActionPurge, &old, nil)
+	err = writeAuditEvent(ctx, tx, event.CreatedAt, event)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	err = writeOutboxEvent(ctx, tx, event.CreatedAt, event, &old)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	return contextError(ctx, tx.Commit())
 }
 
-func (m HeroModel) GetAll(name string, abilities []string, filters Filters) ([]*Hero, error) {
+// History returns a page of the audit events of a hero. Events of deleted
+// heroes are kept.
+func (m HeroModel) History(ctx context.Context, heroID int64, filters Filters) ([]*AuditEvent, Metadata, error) {
+	ctx, cancel := withQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
 	query := fmt.Sprintf(`
-        SELECT id, first_seen, name, can_fly, realname, abilities, version
-        FROM heroes
+        SELECT count(*) OVER(), id, hero_id, action, actor, version, changes, created_at
+        FROM audit_events
+        WHERE hero_id = $1
+        ORDER BY %s
+        LIMIT $2 OFFSET $3`, filters.orderBy())
+
+	rows, err := m.DB.QueryContext(ctx, query, heroID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, contextError(ctx, err)
+	}
+
+	defer rows.Close()
+
+	totalRecords := 0
+	events := []*AuditEvent{}
+
+	for rows.Next() {
+		var event AuditEvent
+		var changes []byte
+
+		err := rows.Scan(
+			&totalRecords,
+			&event.ID,
+			&event.HeroID,
+			&event.Action,
+			&event.Actor,
+			&event.Version,
+			&changes,
+			&event.CreatedAt,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		err = json.Unmarshal(changes, &event.Changes)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		events = append(events, &event)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, contextError(ctx, err)
+	}
+
+	if filters.pastLastPage(len(events)) {
+		totalRecords, err = countRows(ctx, m.DB, "SELECT id FROM audit_events WHERE hero_id = $1", heroID)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+	}
+
+	return events, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+// listQuery returns the query selecting the heroes matching heroFilter in
+// the order of filters. If paged is set, it selects the page of filters plus
+// one additional row and counts all matches (unless a cursor is used).
+//
+// Heroes are selected from a subquery adding the relevance column, so it can
+// be used in seek predicates like any other column.
+func (m HeroModel) listQuery(heroFilter HeroFilter, filters Filters, paged bool) (string, []interface{}, error) {
+	// Fetch one additional row to find out whether there is a next page
+	args := []interface{}{heroFilter.Name, pq.Array(heroFilter.Abilities), filters.limit() + 1, filters.offset(), heroFilter.IncludeDeleted}
+
+	// Optional criteria are only added to the query if they are set
+	where := []string{"TRUE"}
+	relevance := "0"
+	if heroFilter.Q != "" {
+		// The search document is indexed (see migrations)
+		args = append(args, heroFilter.Q)
+		document := "heroes_search_document(name, realname, abilities)"
+		query := fmt.Sprintf("plainto_tsquery('simple', $%d)", len(args))
+		relevance = fmt.Sprintf("-ts_rank(%s, %s, 2)", document, query)
+		where = append(where, fmt.Sprintf("%s @@ %s", document, query))
+	}
+
+	if !heroFilter.FirstSeenFrom.IsZero() {
+		args = append(args, heroFilter.FirstSeenFrom)
+		where = append(where, fmt.Sprintf("first_seen >= $%d", len(args)))
+	}
+
+	if !heroFilter.FirstSeenTo.IsZero() {
+		args = append(args, heroFilter.FirstSeenTo)
+		where = append(where, fmt.Sprintf("first_seen <= $%d", len(args)))
+	}
+
+	if heroFilter.CanFly != nil {
+		args = append(args, *heroFilter.CanFly)
+		where = append(where, fmt.Sprintf("can_fly = $%d", len(args)))
+	}
+
+	// Counting all matches would defeat the purpose of keyset pagination
+	totalRecordsExpr := "count(*) OVER()"
+	seek := "TRUE"
+	switch {
+	case !paged:
+		// LIMIT NULL selects all rows
+		totalRecordsExpr = "0"
+		args[2], args[3] = nil, 0
+	case filters.Cursor != "":
+		predicate, seekArgs, err := filters.seekPredicate(len(args) + 1)
+		if err != nil {
+			return "", nil, err
+		}
+
+		totalRecordsExpr = "0"
+		seek = predicate
+		args[3] = 0
+		args = append(args, seekArgs...)
+	}
+
+	query := fmt.Sprintf(`
+        SELECT %s, id, first_seen, name, can_fly, realname, abilities, version, deleted_at, relevance
+        FROM (SELECT *, %s AS relevance FROM heroes WHERE %s) AS heroes
         WHERE (LOWER(name) LIKE LOWER($1) OR $1 = '') 
         AND (abilities @> $2 OR $2 = '{}')     
-        ORDER BY %s ASC, id ASC
-        LIMIT $3 OFFSET $4`, filters.Sort)
+        AND (deleted_at IS NULL OR $5)
+        AND %s
+        ORDER BY %s
+        LIMIT $3 OFFSET $4`, totalRecordsExpr, relevance, strings.Join(where, " AND "), seek, filters.orderBy())
+
+	return query, args, nil
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// GetAll returns a page of heroes. If filters contain a cursor, the page is
+// selected with a seek predicate on the sort keys instead of an offset.
+func (m HeroModel) GetAll(ctx context.Context, heroFilter HeroFilter, filters Filters) ([]*Hero, Metadata, error) {
+	ctx, cancel := withQueryTimeout(ctx, m.QueryTimeout)
 	defer cancel()
 
-	args := []interface{}{name, pq.Array(abilities), filters.limit(), filters.offset()}
+	query, args, err := m.listQuery(heroFilter, filters, true)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
 	rows, err := m.DB.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, err
+		return nil, Metadata{}, contextError(ctx, err)
 	}
 
 	defer rows.Close()
 
+	totalRecords := 0
 	heroes := []*Hero{}
 
 	for rows.Next() {
 		var hero Hero
 
-		err := rows.Scan(
-			&hero.ID,
-			&hero.FirstSeen,
-			&hero.Name,
-			&hero.CanFly,
-			&hero.RealName,
-			pq.Array(&hero.Abilities),
-			&hero.Version,
-		)
+		err := rows.Scan(listDest(&totalRecords, &hero)...)
 		if err != nil {
-			return nil, err
+			return nil, Metadata{}, err
 		}
 
 		heroes = append(heroes, &hero)
 	}
 
 	if err = rows.Err(); err != nil {
-		return nil, err
+		return nil, Metadata{}, contextError(ctx, err)
+	}
+
+	if filters.pastLastPage(len(heroes)) {
+		query, args, err := m.listQuery(heroFilter, filters, false)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		totalRecords, err = countRows(ctx, m.DB, query, args...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+	}
+
+	heroes, metadata := pageMetadata(heroes, totalRecords, filters)
+
+	return heroes, metadata, nil
+}
+
+// Stream calls fn for every hero matching heroFilter in the order of
+// filters, paging options are ignored. Rows are read one at a time, so
+// arbitrarily many heroes can be processed. The query timeout does not
+// apply, cancel ctx to abort.
+func (m HeroModel) Stream(ctx context.Context, heroFilter HeroFilter, filters Filters, fn func(*Hero) error) error {
+	query, args, err := m.listQuery(heroFilter, filters, false)
+	if err != nil {
+		return err
+	}
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var totalRecords int
+		var hero Hero
+
+		err := rows.Scan(listDest(&totalRecords, &hero)...)
+		if err != nil {
+			return err
+		}
+
+		err = fn(&hero)
+		if err != nil {
+			return err
+		}
+	}
+
+	return contextError(ctx, rows.Err())
+}
+
+// pageMetadata trims the additional row fetched to detect a next page and
+// calculates the metadata for the page.
+func pageMetadata(heroes []*Hero, totalRecords int, filters Filters) ([]*Hero, Metadata) {
+	var metadata Metadata
+	if filters.Cursor != "" {
+		metadata = Metadata{PageSize: filters.PageSize}
+	} else {
+		metadata = calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	}
+
+	if len(heroes) > filters.limit() {
+		heroes = heroes[:filters.limit()]
+		metadata.NextCursor = filters.nextCursor(heroes[len(heroes)-1].sortValue)
 	}
 
-	return heroes, nil
+	return heroes, metadata
 }
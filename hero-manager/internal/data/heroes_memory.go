@@ -0,0 +1,491 @@
+package data
+
+import (
+	"cmp"
+	"context"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryHeroModel is a HeroesRepository keeping all heroes in memory.
+// It mirrors the semantics of HeroModel and is meant for local development
+// and tests. All data is lost when the process ends.
+type MemoryHeroModel struct {
+	mu     sync.RWMutex
+	heroes map[int64]*Hero
+	nextID int64
+	events []*AuditEvent
+	rivals map[[2]int64]bool // keys ordered by rivalryKey
+
+	// Memberships are removed from teams when heroes are deleted. To avoid
+	// deadlocks, the heroes' lock is always acquired before the teams' one.
+	teams *MemoryTeamModel
+
+	// Events publishing changes, nil if heroes have no outbox. The outbox
+	// never acquires the heroes' lock.
+	outbox *MemoryOutboxModel
+}
+
+func NewMemoryHeroModel() *MemoryHeroModel {
+	return &MemoryHeroModel{heroes: make(map[int64]*Hero), nextID: 1, rivals: make(map[[2]int64]bool)}
+}
+
+// copyHero returns a deep copy so that callers cannot modify stored heroes.
+func copyHero(hero *Hero) *Hero {
+	c := *hero
+	if hero.Abilities != nil {
+		c.Abilities = append([]string{}, hero.Abilities...)
+	}
+
+	if hero.DeletedAt != nil {
+		deletedAt := *hero.DeletedAt
+		c.DeletedAt = &deletedAt
+	}
+
+	return &c
+}
+
+func (m *MemoryHeroModel) Insert(ctx context.Context, hero *Hero) error {
+	return m.InsertMany(ctx, []*Hero{hero})
+}
+
+func (m *MemoryHeroModel) InsertMany(ctx context.Context, heroes []*Hero) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, hero := range heroes {
+		hero.ID = m.nextID
+		hero.Version = 1
+		m.nextID++
+		m.heroes[hero.ID] = copyHero(hero)
+		m.audit(newAuditEvent(ctx, AuditActionCreate, nil, m.heroes[hero.ID]), m.heroes[hero.ID])
+	}
+
+	return nil
+}
+
+// audit records an event and adds the event publishing the change of hero
+// to the outbox. The caller must hold the write lock.
+func (m *MemoryHeroModel) audit(event *AuditEvent, hero *Hero) {
+	event.ID = int64(len(m.events)) + 1
+	m.events = append(m.events, event)
+
+	if m.outbox != nil {
+		m.outbox.add(event, hero)
+	}
+}
+
+func (m *MemoryHeroModel) Get(ctx context.Context, id int64) (*Hero, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	hero, ok := m.heroes[id]
+	if !ok || hero.DeletedAt != nil {
+		return nil, ErrRecordNotFound
+	}
+
+	return copyHero(hero), nil
+}
+
+func (m *MemoryHeroModel) Update(ctx context.Context, hero *Hero) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.heroes[hero.ID]
+	if !ok || stored.Version != hero.Version || stored.DeletedAt != nil {
+		return ErrEditConflict
+	}
+
+	hero.Version++
+	m.heroes[hero.ID] = copyHero(hero)
+	m.audit(newAuditEvent(ctx, AuditActionUpdate, stored, m.heroes[hero.ID]), m.heroes[hero.ID])
+
+	return nil
+}
+
+func (m *MemoryHeroModel) Delete(ctx context.Context, id int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.heroes[id]
+	if !ok || stored.DeletedAt != nil {
+		return ErrRecordNotFound
+	}
+
+	hero := copyHero(stored)
+	deletedAt := time.Now().UTC().Truncate(time.Second)
+	hero.DeletedAt = &deletedAt
+	hero.Version++
+	m.heroes[id] = hero
+	m.deleteRelations(id)
+	m.audit(newAuditEvent(ctx, AuditActionDelete, stored, hero), hero)
+
+	return nil
+}
+
+func (m *MemoryHeroModel) Restore(ctx context.Context, id int64) (*Hero, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.heroes[id]
+	if !ok || stored.DeletedAt == nil {
+		return nil, ErrRecordNotFound
+	}
+
+	hero := copyHero(stored)
+	hero.DeletedAt = nil
+	hero.Version++
+	m.heroes[id] = hero
+	m.audit(newAuditEvent(ctx, AuditActionRestore, stored, hero), hero)
+
+	return copyHero(hero), nil
+}
+
+func (m *MemoryHeroModel) Purge(ctx context.Context, id int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.heroes[id]
+	if !ok {
+		return ErrRecordNotFound
+	}
+
+	delete(m.heroes, id)
+	m.deleteRelations(id)
+	m.audit(newAuditEvent(ctx, AuditActionPurge, stored, nil), stored)
+
+	return nil
+}
+
+// deleteRelations removes a hero from all teams and rivalries. The caller
+// must hold the write lock.
+func (m *MemoryHeroModel) deleteRelations(id int64) {
+	for key := range m.rivals {
+		if key[0] == id || key[1] == id {
+			delete(m.rivals, key)
+		}
+	}
+
+	if m.teams != nil {
+		m.teams.removeHero(id)
+	}
+}
+
+// active returns a stored hero unless it does not exist or has been
+// deleted. The caller must hold the read lock.
+func (m *MemoryHeroModel) active(id int64) (*Hero, bool) {
+	hero, ok := m.heroes[id]
+	return hero, ok && hero.DeletedAt == nil
+}
+
+func (m *MemoryHeroModel) AddRival(ctx context.Context, heroID, rivalID int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, heroOK := m.active(heroID)
+	_, rivalOK := m.active(rivalID)
+	if !heroOK || !rivalOK || heroID == rivalID {
+		return ErrRecordNotFound
+	}
+
+	heroID, rivalID = rivalryKey(heroID, rivalID)
+	m.rivals[[2]int64{heroID, rivalID}] = true
+
+	return nil
+}
+
+func (m *MemoryHeroModel) RemoveRival(ctx context.Context, heroID, rivalID int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	heroID, rivalID = rivalryKey(heroID, rivalID)
+	key := [2]int64{heroID, rivalID}
+	if !m.rivals[key] {
+		return ErrRecordNotFound
+	}
+
+	delete(m.rivals, key)
+
+	return nil
+}
+
+func (m *MemoryHeroModel) Rivals(ctx context.Context, heroID int64) ([]*Hero, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	rivals := []*Hero{}
+	for key := range m.rivals {
+		rivalID := key[0]
+		switch heroID {
+		case key[0]:
+			rivalID = key[1]
+		case key[1]:
+		default:
+			continue
+		}
+
+		if rival, ok := m.active(rivalID); ok {
+			rivals = append(rivals, copyHero(rival))
+		}
+	}
+
+	sortHeroesByName(rivals)
+
+	return rivals, nil
+}
+
+func sortHeroesByName(heroes []*Hero) {
+	slices.SortFunc(heroes, func(a, b *Hero) int {
+		return cmp.Or(strings.Compare(a.Name, b.Name), cmp.Compare(a.ID, b.ID))
+	})
+}
+
+func (m *MemoryHeroModel) GetAll(ctx context.Context, heroFilter HeroFilter, filters Filters) ([]*Hero, Metadata, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	var after []string
+	if filters.Cursor != "" {
+		c, err := filters.cursor()
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		after = c.Values
+	}
+
+	m.mu.RLock()
+	matches := m.matching(heroFilter, filters, after)
+	m.mu.RUnlock()
+
+	totalRecords := len(matches)
+	if after == nil {
+		matches = matches[min(filters.offset(), len(matches)):]
+	} else {
+		totalRecords = 0
+	}
+
+	heroes := matches[:min(filters.limit()+1, len(matches))]
+	heroes, metadata := pageMetadata(heroes, totalRecords, filters)
+
+	return heroes, metadata, nil
+}
+
+func (m *MemoryHeroModel) Stream(ctx context.Context, heroFilter HeroFilter, filters Filters, fn func(*Hero) error) error {
+	m.mu.RLock()
+	heroes := m.matching(heroFilter, filters, nil)
+	m.mu.RUnlock()
+
+	for _, hero := range heroes {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		err := fn(hero)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// matching returns copies of all heroes matching heroFilter in the order of
+// filters. If after is given, only heroes sorted after these sort key values
+// are returned. The caller must hold the read lock.
+func (m *MemoryHeroModel) matching(heroFilter HeroFilter, filters Filters, after []string) []*Hero {
+	nameRX := likeToRegexp(heroFilter.Name)
+	query := searchTokens(heroFilter.Q)
+	keys := filters.sortKeys()
+
+	matches := []*Hero{}
+	for _, hero := range m.heroes {
+		if heroFilter.Name != "" && !nameRX.MatchString(hero.Name) {
+			continue
+		}
+
+		if !containsAll(hero.Abilities, heroFilter.Abilities) {
+			continue
+		}
+
+		if !heroFilter.FirstSeenFrom.IsZero() && hero.FirstSeen.Before(heroFilter.FirstSeenFrom) {
+			continue
+		}
+
+		if !heroFilter.FirstSeenTo.IsZero() && hero.FirstSeen.After(heroFilter.FirstSeenTo) {
+			continue
+		}
+
+		if heroFilter.CanFly != nil && hero.CanFly != *heroFilter.CanFly {
+			continue
+		}
+
+		if hero.DeletedAt != nil && !heroFilter.IncludeDeleted {
+			continue
+		}
+
+		match := copyHero(hero)
+		if heroFilter.Q != "" {
+			rank := searchRank(hero.Name, hero.RealName, hero.Abilities, query)
+			if rank == 0 {
+				continue
+			}
+
+			match.relevance = -rank
+		}
+
+		if after != nil && compareSortValues(keys, sortValues(keys, match), after) <= 0 {
+			continue
+		}
+
+		matches = append(matches, match)
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		return compareSortValues(keys, sortValues(keys, matches[i]), sortValues(keys, matches[j])) < 0
+	})
+
+	return matches
+}
+
+func (m *MemoryHeroModel) History(ctx context.Context, heroID int64, filters Filters) ([]*AuditEvent, Metadata, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	matches := []*AuditEvent{}
+	for _, event := range m.events {
+		if event.HeroID == heroID {
+			matches = append(matches, event)
+		}
+	}
+
+	// Events are appended in id order, id is the only sort column
+	if keys := filters.sortKeys(); keys[0].Descending {
+		slices.Reverse(matches)
+	}
+
+	totalRecords := len(matches)
+	matches = matches[min(filters.offset(), len(matches)):]
+
+	events := []*AuditEvent{}
+	for _, event := range matches[:min(filters.limit(), len(matches))] {
+		c := *event
+		events = append(events, &c)
+	}
+
+	return events, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+// likeToRegexp translates a case-insensitive SQL LIKE pattern into a regular expression.
+func likeToRegexp(pattern string) *regexp.Regexp {
+	var rx strings.Builder
+	rx.WriteString("(?is)^")
+	for _, r := range pattern {
+		switch r {
+		case '%':
+			rx.WriteString(".*")
+		case '_':
+			rx.WriteString(".")
+		default:
+			rx.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	rx.WriteString("$")
+
+	return regexp.MustCompile(rx.String())
+}
+
+func containsAll(values []string, required []string) bool {
+	for _, r := range required {
+		if !slices.Contains(values, r) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func sortValues(keys []sortKey, hero *Hero) []string {
+	values := []string{}
+	for _, key := range keys {
+		values = append(values, hero.sortValue(key.Column))
+	}
+
+	return values
+}
+
+// compareSortValues compares two rows represented by their sort key values
+// in the order given by keys.
+func compareSortValues(keys []sortKey, a, b []string) int {
+	for i, key := range keys {
+		var c int
+		switch key.Column {
+		case "id":
+			x, _ := strconv.ParseInt(a[i], 10, 64)
+			y, _ := strconv.ParseInt(b[i], 10, 64)
+			c = cmp.Compare(x, y)
+		case "relevance":
+			x, _ := strconv.ParseFloat(a[i], 64)
+			y, _ := strconv.ParseFloat(b[i], 64)
+			c = cmp.Compare(x, y)
+		default:
+			c = strings.Compare(a[i], b[i])
+		}
+
+		if key.Descending {
+			c = -c
+		}
+
+		if c != 0 {
+			return c
+		}
+	}
+
+	return 0
+}
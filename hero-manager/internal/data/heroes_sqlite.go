@@ -0,0 +1,695 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"modernc.org/sqlite"
+)
+
+//go:embed schema_sqlite.sql
+var sqliteSchema string
+
+// hero_search_rank(name, realname, abilities, q) ranks heroes like
+// MemoryHeroModel does, SQLite has no built-in equivalent of PostgreSQL's
+// full-text search.
+func init() {
+	sqlite.MustRegisterDeterministicScalarFunction("hero_search_rank", 4, func(ctx *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		var abilities []string
+		values := make([]string, len(args))
+		for i, arg := range args {
+			switch arg := arg.(type) {
+			case string:
+				values[i] = arg
+			case []byte:
+				values[i] = string(arg)
+			}
+		}
+
+		err := json.Unmarshal([]byte(values[2]), &abilities)
+		if err != nil {
+			return nil, err
+		}
+
+		return searchRank(values[0], values[1], abilities, searchTokens(values[3])), nil
+	})
+}
+
+// Timestamps are stored as text in UTC with second precision (like
+// timestamp(0) in PostgreSQL) so that they sort correctly.
+const sqliteTimeFormat = "2006-01-02 15:04:05"
+
+// CreateSQLiteSchema creates all tables in a SQLite database if they do not exist yet.
+func CreateSQLiteSchema(db *sql.DB) error {
+	_, err := db.Exec(sqliteSchema)
+	return err
+}
+
+// SQLiteHeroModel is a HeroesRepository storing heroes in an embedded SQLite
+// database. Abilities are stored as a JSON array.
+type SQLiteHeroModel struct {
+	DB           *sql.DB
+	QueryTimeout time.Duration
+}
+
+// sqliteHeroScanner scans a hero row with text encoded first_seen, abilities
+// and deleted_at columns.
+type sqliteHeroScanner struct {
+	hero      Hero
+	firstSeen string
+	abilities string
+	deletedAt sql.NullString
+}
+
+func (s *sqliteHeroScanner) dest() []interface{} {
+	return []interface{}{
+		&s.hero.ID,
+		&s.firstSeen,
+		&s.hero.Name,
+		&s.hero.CanFly,
+		&s.hero.RealName,
+		&s.abilities,
+		&s.hero.Version,
+		&s.deletedAt,
+	}
+}
+
+// listDest returns the scan destinations for rows of listQuery.
+func (s *sqliteHeroScanner) listDest(totalRecords *int) []interface{} {
+	dest := append([]interface{}{totalRecords}, s.dest()...)
+	return append(dest, &s.hero.relevance)
+}
+
+func (s *sqliteHeroScanner) result() (*Hero, error) {
+	hero := s.hero
+
+	firstSeen, err := time.Parse(sqliteTimeFormat, s.firstSeen)
+	if err != nil {
+		return nil, err
+	}
+	hero.FirstSeen = firstSeen
+
+	err = json.Unmarshal([]byte(s.abilities), &hero.Abilities)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.deletedAt.Valid {
+		deletedAt, err := time.Parse(sqliteTimeFormat, s.deletedAt.String)
+		if err != nil {
+			return nil, err
+		}
+		hero.DeletedAt = &deletedAt
+	}
+
+	return &hero, nil
+}
+
+func sqliteTime(t time.Time) string {
+	return t.UTC().Format(sqliteTimeFormat)
+}
+
+func sqliteStrings(values []string) (string, error) {
+	if values == nil {
+		values = []string{}
+	}
+
+	js, err := json.Marshal(values)
+	return string(js), err
+}
+
+func (m SQLiteHeroModel) Insert(ctx context.Context, hero *Hero) error {
+	return m.InsertMany(ctx, []*Hero{hero})
+}
+
+func (m SQLiteHeroModel) InsertMany(ctx context.Context, heroes []*Hero) error {
+	ctx, cancel := withQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	defer tx.Rollback()
+
+	query := `
+        INSERT INTO heroes (first_seen, name, can_fly, realname, abilities) 
+        VALUES ($1, $2, $3, $4, $5)
+        RETURNING id, version`
+
+	for _, hero := range heroes {
+		abilities, err := sqliteStrings(hero.Abilities)
+		if err != nil {
+			return err
+		}
+
+		args := []interface{}{sqliteTime(hero.FirstSeen), hero.Name, hero.CanFly, hero.RealName, abilities}
+		err = tx.QueryRowContext(ctx, query, args...).Scan(&hero.ID, &hero.Version)
+		if err != nil {
+			return contextError(ctx, err)
+		}
+
+		event := newAuditEvent(ctx, AuditActionCreate, nil, hero)
+		err = writeAuditEvent(ctx, tx, sqliteTime(event.CreatedAt), event)
+		if err != nil {
+			return contextError(ctx, err)
+		}
+
+		err = writeOutboxEvent(ctx, tx, sqliteTime(event.CreatedAt), event, hero)
+		if err != nil {
+			return contextError(ctx, err)
+		}
+	}
+
+	return contextError(ctx, tx.Commit())
+}
+
+func (m SQLiteHeroModel) Get(ctx context.Context, id int64) (*Hero, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	ctx, cancel := withQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	query := `
+        SELECT id, first_seen, name, can_fly, realname, abilities, version, deleted_at
+        FROM heroes
+        WHERE id = $1 AND deleted_at IS NULL`
+
+	var s sqliteHeroScanner
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(s.dest()...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, contextError(ctx, err)
+		}
+	}
+
+	return s.result()
+}
+
+func (m SQLiteHeroModel) Update(ctx context.Context, hero *Hero) error {
+	ctx, cancel := withQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	abilities, err := sqliteStrings(hero.Abilities)
+	if err != nil {
+		return err
+	}
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	defer tx.Rollback()
+
+	// SQLite has no row locks, the transaction serializes writers.
+	query := `
+        SELECT id, first_seen, name, can_fly, realname, abilities, version, deleted_at
+        FROM heroes
+        WHERE id = $1 AND version = $2 AND deleted_at IS NULL`
+
+	var s sqliteHeroScanner
+
+	err = tx.QueryRowContext(ctx, query, hero.ID, hero.Version).Scan(s.dest()...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return contextError(ctx, err)
+		}
+	}
+
+	old, err := s.result()
+	if err != nil {
+		return err
+	}
+
+	query = `
+        UPDATE heroes
+        SET first_seen = $1, name = $2, can_fly = $3, realname = $4, abilities = $5, version = version + 1
+        WHERE id = $6 AND version = $7
+        RETURNING version`
+
+	args := []interface{}{
+		sqliteTime(hero.FirstSeen),
+		hero.Name,
+		hero.CanFly,
+		hero.RealName,
+		abilities,
+		hero.ID,
+		hero.Version,
+	}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&hero.Version)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	event := newAuditEvent(ctx, AuditActionUpdate, old, hero)
+	err = writeAuditEvent(ctx, tx, sqliteTime(event.CreatedAt), event)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	err = writeOutboxEvent(ctx, tx, sqliteTime(event.CreatedAt), event, hero)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	return contextError(ctx, tx.Commit())
+}
+
+func (m SQLiteHeroModel) Delete(ctx context.Context, id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	ctx, cancel := withQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	defer tx.Rollback()
+
+	query := `
+        UPDATE heroes
+        SET deleted_at = $2, version = version + 1
+        WHERE id = $1 AND deleted_at IS NULL
+        RETURNING id, first_seen, name, can_fly, realname, abilities, version, deleted_at`
+
+	var s sqliteHeroScanner
+
+	err = tx.QueryRowContext(ctx, query, id, sqliteTime(time.Now())).Scan(s.dest()...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return contextError(ctx, err)
+		}
+	}
+
+	hero, err := s.result()
+	if err != nil {
+		return err
+	}
+
+	// Only deleted_at and the version have changed
+	old := *hero
+	old.DeletedAt = nil
+	old.Version--
+
+	err = deleteHeroRelations(ctx, tx, id)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	event := newAuditEvent(ctx, AuditActionDelete, &old, hero)
+	err = writeAuditEvent(ctx, tx, sqliteTime(event.CreatedAt), event)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	err = writeOutboxEvent(ctx, tx, sqliteTime(event.CreatedAt), event, hero)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	return contextError(ctx, tx.Commit())
+}
+
+func (m SQLiteHeroModel) Restore(ctx context.Context, id int64) (*Hero, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	ctx, cancel := withQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	defer tx.Rollback()
+
+	query := `
+        SELECT id, first_seen, name, can_fly, realname, abilities, version, deleted_at
+        FROM heroes
+        WHERE id = $1 AND deleted_at IS NOT NULL`
+
+	var s sqliteHeroScanner
+
+	err = tx.QueryRowContext(ctx, query, id).Scan(s.dest()...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, contextError(ctx, err)
+		}
+	}
+
+	old, err := s.result()
+	if err != nil {
+		return nil, err
+	}
+
+	hero := *old
+	hero.DeletedAt = nil
+
+	query = `
+        UPDATE heroes
+        SET deleted_at = NULL, version = version + 1
+        WHERE id = $1
+        RETURNING version`
+
+	err = tx.QueryRowContext(ctx, query, id).Scan(&hero.Version)
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	event := newAuditEvent(ctx, AuditActionRestore, old, &hero)
+	err = writeAuditEvent(ctx, tx, sqliteTime(event.CreatedAt), event)
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	err = writeOutboxEvent(ctx, tx, sqliteTime(event.CreatedAt), event, &hero)
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	return &hero, nil
+}
+
+func (m SQLiteHeroModel) Purge(ctx context.Context, id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	ctx, cancel := withQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	defer tx.Rollback()
+
+	query := `
+        DELETE FROM heroes
+        WHERE id = $1
+        RETURNING id, first_seen, name, can_fly, realname, abilities, version, deleted_at`
+
+	var s sqliteHeroScanner
+
+	err = tx.QueryRowContext(ctx, query, id).Scan(s.dest()...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return contextError(ctx, err)
+		}
+	}
+
+	old, err := s.result()
+	if err != nil {
+		return err
+	}
+
+	err = deleteHeroRelations(ctx, tx, id)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	event := newAuditEvent(ctx, AuditActionPurge, old, nil)
+	err = writeAuditEvent(ctx, tx, sqliteTime(event.CreatedAt), event)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	err = writeOutboxEvent(ctx, tx, sqliteTime(event.CreatedAt), event, old)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	return contextError(ctx, tx.Commit())
+}
+
+func (m SQLiteHeroModel) History(ctx context.Context, heroID int64, filters Filters) ([]*AuditEvent, Metadata, error) {
+	ctx, cancel := withQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	query := fmt.Sprintf(`
+        SELECT count(*) OVER(), id, hero_id, action, actor, version, changes, created_at
+        FROM audit_events
+        WHERE hero_id = $1
+        ORDER BY %s
+        LIMIT $2 OFFSET $3`, filters.orderBy())
+
+	rows, err := m.DB.QueryContext(ctx, query, heroID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, contextError(ctx, err)
+	}
+
+	defer rows.Close()
+
+	totalRecords := 0
+	events := []*AuditEvent{}
+
+	for rows.Next() {
+		var event AuditEvent
+		var changes, createdAt string
+
+		err := rows.Scan(
+			&totalRecords,
+			&event.ID,
+			&event.HeroID,
+			&event.Action,
+			&event.Actor,
+			&event.Version,
+			&changes,
+			&createdAt,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		err = json.Unmarshal([]byte(changes), &event.Changes)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		event.CreatedAt, err = time.Parse(sqliteTimeFormat, createdAt)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		events = append(events, &event)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, contextError(ctx, err)
+	}
+
+	if filters.pastLastPage(len(events)) {
+		totalRecords, err = countRows(ctx, m.DB, "SELECT id FROM audit_events WHERE hero_id = $1", heroID)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+	}
+
+	return events, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+// listQuery returns the query selecting the heroes matching heroFilter in
+// the order of filters. See HeroModel.listQuery.
+func (m SQLiteHeroModel) listQuery(heroFilter HeroFilter, filters Filters, paged bool) (string, []interface{}, error) {
+	requiredAbilities, err := sqliteStrings(heroFilter.Abilities)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// Fetch one additional row to find out whether there is a next page
+	args := []interface{}{heroFilter.Name, requiredAbilities, filters.limit() + 1, filters.offset(), heroFilter.IncludeDeleted}
+
+	// Optional criteria are only added to the query if they are set
+	where := []string{"TRUE"}
+	relevance := "0"
+	if heroFilter.Q != "" {
+		args = append(args, heroFilter.Q)
+		rank := fmt.Sprintf("hero_search_rank(name, realname, abilities, $%d)", len(args))
+
+		// The cast gives the column numeric affinity, so that it is compared
+		// numerically with the text values of seek predicates.
+		relevance = fmt.Sprintf("CAST(-%s AS REAL)", rank)
+		where = append(where, fmt.Sprintf("%s > 0", rank))
+	}
+
+	if !heroFilter.FirstSeenFrom.IsZero() {
+		args = append(args, sqliteTime(heroFilter.FirstSeenFrom))
+		where = append(where, fmt.Sprintf("first_seen >= $%d", len(args)))
+	}
+
+	if !heroFilter.FirstSeenTo.IsZero() {
+		args = append(args, sqliteTime(heroFilter.FirstSeenTo))
+		where = append(where, fmt.Sprintf("first_seen <= $%d", len(args)))
+	}
+
+	if heroFilter.CanFly != nil {
+		args = append(args, *heroFilter.CanFly)
+		where = append(where, fmt.Sprintf("can_fly = $%d", len(args)))
+	}
+
+	totalRecordsExpr := "count(*) OVER()"
+	seek := "TRUE"
+	switch {
+	case !paged:
+		// A negative limit selects all rows
+		totalRecordsExpr = "0"
+		args[2], args[3] = -1, 0
+	case filters.Cursor != "":
+		predicate, seekArgs, err := filters.seekPredicate(len(args) + 1)
+		if err != nil {
+			return "", nil, err
+		}
+
+		totalRecordsExpr = "0"
+		seek = predicate
+		args[3] = 0
+		args = append(args, seekArgs...)
+	}
+
+	// Abilities are contained if none of the required ones is missing
+	query := fmt.Sprintf(`
+        SELECT %s, id, first_seen, name, can_fly, realname, abilities, version, deleted_at, relevance
+        FROM (SELECT *, %s AS relevance FROM heroes WHERE %s) AS heroes
+        WHERE (LOWER(name) LIKE LOWER($1) OR $1 = '')
+        AND NOT EXISTS (
+            SELECT 1 FROM json_each($2) AS required
+            WHERE required.value NOT IN (SELECT value FROM json_each(heroes.abilities)))
+        AND (deleted_at IS NULL OR $5)
+        AND %s
+        ORDER BY %s
+        LIMIT $3 OFFSET $4`, totalRecordsExpr, relevance, strings.Join(where, " AND "), seek, filters.orderBy())
+
+	return query, args, nil
+}
+
+func (m SQLiteHeroModel) GetAll(ctx context.Context, heroFilter HeroFilter, filters Filters) ([]*Hero, Metadata, error) {
+	ctx, cancel := withQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	query, args, err := m.listQuery(heroFilter, filters, true)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, contextError(ctx, err)
+	}
+
+	defer rows.Close()
+
+	totalRecords := 0
+	heroes := []*Hero{}
+
+	for rows.Next() {
+		var s sqliteHeroScanner
+
+		err := rows.Scan(s.listDest(&totalRecords)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		hero, err := s.result()
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		heroes = append(heroes, hero)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, contextError(ctx, err)
+	}
+
+	if filters.pastLastPage(len(heroes)) {
+		query, args, err := m.listQuery(heroFilter, filters, false)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		totalRecords, err = countRows(ctx, m.DB, query, args...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+	}
+
+	heroes, metadata := pageMetadata(heroes, totalRecords, filters)
+
+	return heroes, metadata, nil
+}
+
+func (m SQLiteHeroModel) Stream(ctx context.Context, heroFilter HeroFilter, filters Filters, fn func(*Hero) error) error {
+	query, args, err := m.listQuery(heroFilter, filters, false)
+	if err != nil {
+		return err
+	}
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var totalRecords int
+		var s sqliteHeroScanner
+
+		err := rows.Scan(s.listDest(&totalRecords)...)
+		if err != nil {
+			return err
+		}
+
+		hero, err := s.result()
+		if err != nil {
+			return err
+		}
+
+		err = fn(hero)
+		if err != nil {
+			return err
+		}
+	}
+
+	return contextError(ctx, rows.Err())
+}
@@ -0,0 +1,329 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	_ "modernc.org/sqlite"
+)
+
+// testRepositories returns all repository implementations that can run
+// without an external database server.
+func testRepositories(t *testing.T) map[string]HeroesRepository {
+	return map[string]HeroesRepository{
+		"memory": NewMemoryHeroModel(),
+		"sqlite": SQLiteHeroModel{DB: openTestDB(t)},
+	}
+}
+
+// openTestDB opens an in-memory SQLite database with the schema created.
+func openTestDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	err = CreateSQLiteSchema(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+func insertTestHeroes(t *testing.T, repo HeroesRepository) {
+	ctx := context.Background()
+	heroes := []*Hero{
+		{Name: "Superman", RealName: "Clark Kent", CanFly: true, Abilities: []string{"strength", "flight"}},
+		{Name: "Batman", RealName: "Bruce Wayne", Abilities: []string{"money"}},
+		{Name: "Wonder Woman", RealName: "Diana Prince", Abilities: []string{"strength"}},
+		{Name: "Supergirl", RealName: "Kara Zor-El", CanFly: true, Abilities: []string{"strength", "flight"}},
+	}
+
+	for _, hero := range heroes {
+		hero.FirstSeen = time.Date(1938, 4, 18, 0, 0, 0, 0, time.UTC)
+		err := repo.Insert(ctx, hero)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func heroNames(heroes []*Hero) []string {
+	names := []string{}
+	for _, hero := range heroes {
+		names = append(names, hero.Name)
+	}
+
+	return names
+}
+
+func TestRepositoryCRUD(t *testing.T) {
+	for name, repo := range testRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			insertTestHeroes(t, repo)
+
+			hero, err := repo.Get(ctx, 1)
+			assert.NoError(t, err)
+			assert.Equal(t, "Superman", hero.Name)
+			assert.Equal(t, []string{"strength", "flight"}, hero.Abilities)
+			assert.Equal(t, int32(1), hero.Version)
+			assert.True(t, hero.FirstSeen.Equal(time.Date(1938, 4, 18, 0, 0, 0, 0, time.UTC)))
+
+			hero.RealName = "Kal-El"
+			assert.NoError(t, repo.Update(ctx, hero))
+			assert.Equal(t, int32(2), hero.Version)
+
+			stale := *hero
+			stale.Version = 1
+			assert.ErrorIs(t, repo.Update(ctx, &stale), ErrEditConflict)
+
+			assert.NoError(t, repo.Delete(ctx, 1))
+			_, err = repo.Get(ctx, 1)
+			assert.ErrorIs(t, err, ErrRecordNotFound)
+			assert.ErrorIs(t, repo.Delete(ctx, 1), ErrRecordNotFound)
+		})
+	}
+}
+
+func TestRepositoryGetAll(t *testing.T) {
+	for name, repo := range testRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			insertTestHeroes(t, repo)
+
+			heroes, metadata, err := repo.GetAll(ctx, HeroFilter{Name: "%SUPER%", Abilities: []string{"flight"}}, newTestFilters("-name"))
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"Superman", "Supergirl"}, heroNames(heroes))
+			assert.Equal(t, 2, metadata.TotalRecords)
+
+			heroes, metadata, err = repo.GetAll(ctx, HeroFilter{Name: "%%", Abilities: []string{}}, Filters{Page: 2, PageSize: 3, Sort: "name", SortSafelist: []string{"name"}})
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"Wonder Woman"}, heroNames(heroes))
+			assert.Equal(t, Metadata{CurrentPage: 2, PageSize: 3, FirstPage: 1, LastPage: 2, TotalRecords: 4}, metadata)
+
+			// Pages past the last one still report the total
+			heroes, metadata, err = repo.GetAll(ctx, HeroFilter{Name: "%SUPER%", Abilities: []string{}}, Filters{Page: 5, PageSize: 1, Sort: "name", SortSafelist: []string{"name"}})
+			assert.NoError(t, err)
+			assert.Empty(t, heroes)
+			assert.Equal(t, Metadata{CurrentPage: 5, PageSize: 1, FirstPage: 1, LastPage: 2, TotalRecords: 2}, metadata)
+
+			events, metadata, err := repo.History(ctx, 1, Filters{Page: 3, PageSize: 1, Sort: "id", SortSafelist: []string{"id"}})
+			assert.NoError(t, err)
+			assert.Empty(t, events)
+			assert.Equal(t, Metadata{CurrentPage: 3, PageSize: 1, FirstPage: 1, LastPage: 1, TotalRecords: 1}, metadata)
+		})
+	}
+}
+
+func TestRepositoryCursorPagination(t *testing.T) {
+	for name, repo := range testRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			insertTestHeroes(t, repo)
+
+			filters := Filters{Page: 1, PageSize: 3, Sort: "-name", SortSafelist: []string{"name"}}
+			heroes, metadata, err := repo.GetAll(ctx, HeroFilter{Name: "%%", Abilities: []string{}}, filters)
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"Wonder Woman", "Superman", "Supergirl"}, heroNames(heroes))
+			assert.NotEmpty(t, metadata.NextCursor)
+
+			filters.Cursor = metadata.NextCursor
+			heroes, metadata, err = repo.GetAll(ctx, HeroFilter{Name: "%%", Abilities: []string{}}, filters)
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"Batman"}, heroNames(heroes))
+			assert.Equal(t, Metadata{PageSize: 3}, metadata)
+		})
+	}
+}
+
+func TestRepositoryHistory(t *testing.T) {
+	for name, repo := range testRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := ContextWithActor(context.Background(), "auditor")
+			insertTestHeroes(t, repo)
+
+			hero, err := repo.Get(ctx, 1)
+			assert.NoError(t, err)
+
+			hero.RealName = "Kal-El"
+			assert.NoError(t, repo.Update(ctx, hero))
+			assert.NoError(t, repo.Delete(ctx, 1))
+			assert.NoError(t, repo.Purge(ctx, 1))
+
+			filters := Filters{Page: 1, PageSize: 10, Sort: "id", SortSafelist: []string{"id"}}
+			events, metadata, err := repo.History(ctx, 1, filters)
+			assert.NoError(t, err)
+			assert.Equal(t, 4, metadata.TotalRecords)
+
+			actions := []string{}
+			for _, event := range events {
+				actions = append(actions, event.Action)
+				assert.Equal(t, int64(1), event.HeroID)
+			}
+			assert.Equal(t, []string{AuditActionCreate, AuditActionUpdate, AuditActionDelete, AuditActionPurge}, actions)
+
+			update := events[1]
+			assert.Equal(t, "auditor", update.Actor)
+			assert.Equal(t, int32(2), update.Version)
+			assert.Equal(t, map[string]FieldChange{"realName": {Old: "Clark Kent", New: "Kal-El"}}, update.Changes)
+			assert.Equal(t, []string{"deletedAt"}, mapKeys(events[2].Changes))
+			assert.Equal(t, "Superman", events[3].Changes["name"].Old)
+			assert.Nil(t, events[3].Changes["name"].New)
+
+			filters.Sort, filters.PageSize = "-id", 1
+			events, _, err = repo.History(ctx, 1, filters)
+			assert.NoError(t, err)
+			assert.Equal(t, AuditActionPurge, events[0].Action)
+		})
+	}
+}
+
+func mapKeys(m map[string]FieldChange) []string {
+	keys := []string{}
+	for key := range m {
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+func TestRepositorySoftDelete(t *testing.T) {
+	for name, repo := range testRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			insertTestHeroes(t, repo)
+
+			assert.NoError(t, repo.Delete(ctx, 2))
+			assert.ErrorIs(t, repo.Delete(ctx, 2), ErrRecordNotFound)
+
+			_, err := repo.Get(ctx, 2)
+			assert.ErrorIs(t, err, ErrRecordNotFound)
+
+			heroes, _, err := repo.GetAll(ctx, HeroFilter{}, newTestFilters("name"))
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"Supergirl", "Superman", "Wonder Woman"}, heroNames(heroes))
+
+			heroes, _, err = repo.GetAll(ctx, HeroFilter{IncludeDeleted: true}, newTestFilters("name"))
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"Batman", "Supergirl", "Superman", "Wonder Woman"}, heroNames(heroes))
+			assert.NotNil(t, heroes[0].DeletedAt)
+			assert.Equal(t, int32(2), heroes[0].Version)
+
+			hero, err := repo.Restore(ctx, 2)
+			assert.NoError(t, err)
+			assert.Nil(t, hero.DeletedAt)
+			assert.Equal(t, int32(3), hero.Version)
+
+			_, err = repo.Restore(ctx, 2)
+			assert.ErrorIs(t, err, ErrRecordNotFound)
+
+			hero, err = repo.Get(ctx, 2)
+			assert.NoError(t, err)
+			assert.Equal(t, "Batman", hero.Name)
+			assert.Equal(t, int32(3), hero.Version)
+
+			assert.NoError(t, repo.Purge(ctx, 2))
+			assert.ErrorIs(t, repo.Purge(ctx, 2), ErrRecordNotFound)
+			_, err = repo.Restore(ctx, 2)
+			assert.ErrorIs(t, err, ErrRecordNotFound)
+		})
+	}
+}
+
+func TestRepositoryInsertManyAndStream(t *testing.T) {
+	for name, repo := range testRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			insertTestHeroes(t, repo)
+
+			heroes := []*Hero{
+				{Name: "Flash", Abilities: []string{"speed"}},
+				{Name: "Aquaman", Abilities: []string{"swimming", "strength"}},
+			}
+			assert.NoError(t, repo.InsertMany(ctx, heroes))
+			assert.Equal(t, int64(5), heroes[0].ID)
+			assert.Equal(t, int64(6), heroes[1].ID)
+
+			// Either all heroes are stored or none. Only SQLite checks the
+			// number of abilities, ValidateHero does it for the memory repository.
+			invalid := []*Hero{{Name: "Cyborg", Abilities: []string{"tech"}}, {Name: "Nobody", Abilities: []string{}}}
+			if name != "memory" {
+				assert.Error(t, repo.InsertMany(ctx, invalid))
+			}
+
+			assert.NoError(t, repo.Delete(ctx, 2))
+
+			names := []string{}
+			err := repo.Stream(ctx, HeroFilter{Abilities: []string{"strength"}}, newTestFilters("name"), func(hero *Hero) error {
+				names = append(names, hero.Name)
+				return nil
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"Aquaman", "Supergirl", "Superman", "Wonder Woman"}, names)
+
+			count := 0
+			err = repo.Stream(ctx, HeroFilter{IncludeDeleted: true}, newTestFilters("-id"), func(hero *Hero) error {
+				count++
+				return nil
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, 6, count)
+		})
+	}
+}
+
+func TestRepositoryFirstSeenAndCanFly(t *testing.T) {
+	for name, repo := range testRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			heroes := []*Hero{
+				{Name: "Superman", CanFly: true, FirstSeen: time.Date(1938, 4, 18, 0, 0, 0, 0, time.UTC)},
+				{Name: "Batman", FirstSeen: time.Date(1939, 5, 1, 12, 30, 0, 0, time.UTC)},
+				{Name: "Wonder Woman", FirstSeen: time.Date(1941, 10, 1, 0, 0, 0, 0, time.UTC)},
+				{Name: "Supergirl", CanFly: true, FirstSeen: time.Date(1959, 5, 1, 0, 0, 0, 0, time.UTC)},
+			}
+			for _, hero := range heroes {
+				hero.Abilities = []string{"courage"}
+				assert.NoError(t, repo.Insert(ctx, hero))
+			}
+
+			heroFilter := HeroFilter{
+				FirstSeenFrom: time.Date(1939, 5, 1, 12, 30, 0, 0, time.UTC),
+				FirstSeenTo:   time.Date(1959, 5, 1, 0, 0, 0, 0, time.UTC),
+			}
+			result, _, err := repo.GetAll(ctx, heroFilter, newTestFilters("id"))
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"Batman", "Wonder Woman", "Supergirl"}, heroNames(result))
+
+			canFly := true
+			heroFilter.CanFly = &canFly
+			result, _, err = repo.GetAll(ctx, heroFilter, newTestFilters("id"))
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"Supergirl"}, heroNames(result))
+
+			canFly = false
+			result, _, err = repo.GetAll(ctx, HeroFilter{CanFly: &canFly}, newTestFilters("id"))
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"Batman", "Wonder Woman"}, heroNames(result))
+
+			// Keyset pagination on first_seen
+			filters := Filters{Page: 1, PageSize: 3, Sort: "-first_seen", SortSafelist: []string{"first_seen"}}
+			result, metadata, err := repo.GetAll(ctx, HeroFilter{}, filters)
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"Supergirl", "Wonder Woman", "Batman"}, heroNames(result))
+
+			filters.Cursor = metadata.NextCursor
+			result, _, err = repo.GetAll(ctx, HeroFilter{}, filters)
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"Superman"}, heroNames(result))
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// IdempotencyRecord is the response to a request carrying an
+// Idempotency-Key. Records are stored per authenticated subject, so clients
+// cannot see responses of others by guessing their keys.
+type IdempotencyRecord struct {
+	Subject string
+	Key     string
+
+	// Hash of the request, repeated requests must match it
+	Fingerprint string
+
+	// Response, Status is zero while the request is still being processed
+	Status int
+	Header map[string][]string
+	Body   []byte
+
+	ExpiresAt time.Time
+}
+
+// Completed reports whether the response of the request has been stored.
+func (r *IdempotencyRecord) Completed() bool {
+	return r.Status != 0
+}
+
+// IdempotencyModel is an IdempotencyRepository backed by PostgreSQL.
+type IdempotencyModel struct {
+	DB           *sql.DB
+	QueryTimeout time.Duration
+}
+
+func (m IdempotencyModel) Reserve(ctx context.Context, record *IdempotencyRecord) (*IdempotencyRecord, error) {
+	return reserveIdempotencyKey(ctx, m.DB, m.QueryTimeout, record, record.ExpiresAt, time.Now())
+}
+
+func (m IdempotencyModel) Complete(ctx context.Context, record *IdempotencyRecord) error {
+	return completeIdempotencyKey(ctx, m.DB, m.QueryTimeout, record, record.ExpiresAt)
+}
+
+func (m IdempotencyModel) Release(ctx context.Context, subject, key string) error {
+	ctx, cancel := withQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	query := `
+        DELETE FROM idempotency_keys
+        WHERE subject = $1 AND key = $2 AND status = 0`
+
+	_, err := m.DB.ExecContext(ctx, query, subject, key)
+	return contextError(ctx, err)
+}
+
+// reserveIdempotencyKey implements Reserve for PostgreSQL and SQLite, which
+// store times differently. Expired records are replaced in place. Expired
+// records of other keys are removed on the way.
+func reserveIdempotencyKey(ctx context.Context, db *sql.DB, timeout time.Duration, record *IdempotencyRecord, expiresAt, now interface{}) (*IdempotencyRecord, error) {
+	ctx, cancel := withQueryTimeout(ctx, timeout)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE expires_at <= $1", now)
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	insert := `
+        INSERT INTO idempotency_keys (subject, key, fingerprint, expires_at)
+        VALUES ($1, $2, $3, $4)
+        ON CONFLICT (subject, key) DO UPDATE
+        SET fingerprint = excluded.fingerprint, status = 0, header = '{}', body = '', expires_at = excluded.expires_at
+        WHERE idempotency_keys.expires_at <= $5`
+
+	query := `
+        SELECT fingerprint, status, header, body
+        FROM idempotency_keys
+        WHERE subject = $1 AND key = $2`
+
+	// The existing record can be released between both statements, the key
+	// is free again then.
+	for attempt := 0; attempt < 3; attempt++ {
+		result, err := db.ExecContext(ctx, insert, record.Subject, record.Key, record.Fingerprint, expiresAt, now)
+		if err != nil {
+			return nil, contextError(ctx, err)
+		}
+
+		reserved, err := result.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+
+		if reserved == 1 {
+			return nil, nil
+		}
+
+		existing := IdempotencyRecord{Subject: record.Subject, Key: record.Key}
+		var header []byte
+		err = db.QueryRowContext(ctx, query, record.Subject, record.Key).Scan(
+			&existing.Fingerprint,
+			&existing.Status,
+			&header,
+			&existing.Body,
+		)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+
+		if err != nil {
+			return nil, contextError(ctx, err)
+		}
+
+		if err = json.Unmarshal(header, &existing.Header); err != nil {
+			return nil, err
+		}
+
+		return &existing, nil
+	}
+
+	return nil, errors.New("cannot reserve idempotency key")
+}
+
+// completeIdempotencyKey implements Complete for PostgreSQL and SQLite.
+func completeIdempotencyKey(ctx context.Context, db *sql.DB, timeout time.Duration, record *IdempotencyRecord, expiresAt interface{}) error {
+	header, err := json.Marshal(record.Header)
+	if err != nil {
+		return err
+	}
+
+	body := record.Body
+	if body == nil {
+		body = []byte{}
+	}
+
+	ctx, cancel := withQueryTimeout(ctx, timeout)
+	defer cancel()
+
+	query := `
+        UPDATE idempotency_keys
+        SET status = $3, header = $4, body = $5, expires_at = $6
+        WHERE subject = $1 AND key = $2 AND fingerprint = $7`
+
+	args := []interface{}{record.Subject, record.Key, record.Status, string(header), body, expiresAt, record.Fingerprint}
+	result, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
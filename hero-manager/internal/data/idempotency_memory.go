@@ -0,0 +1,94 @@
+package data
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+// MemoryIdempotencyModel is an IdempotencyRepository keeping all records in
+// memory.
+type MemoryIdempotencyModel struct {
+	mu      sync.Mutex
+	records map[[2]string]*IdempotencyRecord
+}
+
+func NewMemoryIdempotencyModel() *MemoryIdempotencyModel {
+	return &MemoryIdempotencyModel{records: make(map[[2]string]*IdempotencyRecord)}
+}
+
+func (m *MemoryIdempotencyModel) Reserve(ctx context.Context, record *IdempotencyRecord) (*IdempotencyRecord, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for id, r := range m.records {
+		if !r.ExpiresAt.After(now) {
+			delete(m.records, id)
+		}
+	}
+
+	id := [2]string{record.Subject, record.Key}
+	if existing, ok := m.records[id]; ok {
+		return copyIdempotencyRecord(existing), nil
+	}
+
+	reserved := copyIdempotencyRecord(record)
+	reserved.Status, reserved.Header, reserved.Body = 0, nil, nil
+	m.records[id] = reserved
+	return nil, nil
+}
+
+func (m *MemoryIdempotencyModel) Complete(ctx context.Context, record *IdempotencyRecord) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := [2]string{record.Subject, record.Key}
+	existing, ok := m.records[id]
+	if !ok || existing.Fingerprint != record.Fingerprint {
+		return ErrRecordNotFound
+	}
+
+	m.records[id] = copyIdempotencyRecord(record)
+	return nil
+}
+
+func (m *MemoryIdempotencyModel) Release(ctx context.Context, subject, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := [2]string{subject, key}
+	if existing, ok := m.records[id]; ok && !existing.Completed() {
+		delete(m.records, id)
+	}
+
+	return nil
+}
+
+// copyIdempotencyRecord returns a deep copy, so callers cannot modify stored
+// records.
+func copyIdempotencyRecord(record *IdempotencyRecord) *IdempotencyRecord {
+	c := *record
+	c.Body = slices.Clone(record.Body)
+	if record.Header != nil {
+		c.Header = make(map[string][]string, len(record.Header))
+		for name, values := range record.Header {
+			c.Header[name] = slices.Clone(values)
+		}
+	}
+
+	return &c
+}
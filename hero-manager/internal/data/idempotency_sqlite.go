@@ -0,0 +1,20 @@
+package data
+
+import (
+	"context"
+	"time"
+)
+
+// SQLiteIdempotencyModel is an IdempotencyRepository backed by SQLite.
+// expires_at holds Unix milliseconds of the local clock.
+type SQLiteIdempotencyModel struct {
+	IdempotencyModel
+}
+
+func (m SQLiteIdempotencyModel) Reserve(ctx context.Context, record *IdempotencyRecord) (*IdempotencyRecord, error) {
+	return reserveIdempotencyKey(ctx, m.DB, m.QueryTimeout, record, record.ExpiresAt.UnixMilli(), time.Now().UnixMilli())
+}
+
+func (m SQLiteIdempotencyModel) Complete(ctx context.Context, record *IdempotencyRecord) error {
+	return completeIdempotencyKey(ctx, m.DB, m.QueryTimeout, record, record.ExpiresAt.UnixMilli())
+}
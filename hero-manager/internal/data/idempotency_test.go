@@ -0,0 +1,88 @@
+package data
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdempotency(t *testing.T) {
+	for name, models := range testModels(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			record := &IdempotencyRecord{
+				Subject:     "alice",
+				Key:         "key-1",
+				Fingerprint: "a",
+				ExpiresAt:   time.Now().Add(time.Minute),
+			}
+			existing, err := models.Idempotency.Reserve(ctx, record)
+			assert.NoError(t, err)
+			assert.Nil(t, existing)
+
+			// The same key is independent for other subjects
+			other := *record
+			other.Subject = "bob"
+			existing, err = models.Idempotency.Reserve(ctx, &other)
+			assert.NoError(t, err)
+			assert.Nil(t, existing)
+
+			existing, err = models.Idempotency.Reserve(ctx, record)
+			assert.NoError(t, err)
+			if assert.NotNil(t, existing) {
+				assert.False(t, existing.Completed())
+				assert.Equal(t, "a", existing.Fingerprint)
+			}
+
+			record.Status = 201
+			record.Header = map[string][]string{"Location": {"/v1/heroes/1"}}
+			record.Body = []byte(`{"hero":{"id":1}}`)
+			record.ExpiresAt = time.Now().Add(time.Hour)
+			assert.NoError(t, models.Idempotency.Complete(ctx, record))
+
+			// Completed records are not released
+			assert.NoError(t, models.Idempotency.Release(ctx, "alice", "key-1"))
+
+			existing, err = models.Idempotency.Reserve(ctx, &IdempotencyRecord{
+				Subject:     "alice",
+				Key:         "key-1",
+				Fingerprint: "b",
+				ExpiresAt:   time.Now().Add(time.Minute),
+			})
+			assert.NoError(t, err)
+			if assert.NotNil(t, existing) {
+				assert.True(t, existing.Completed())
+				assert.Equal(t, "a", existing.Fingerprint)
+				assert.Equal(t, 201, existing.Status)
+				assert.Equal(t, []string{"/v1/heroes/1"}, existing.Header["Location"])
+				assert.Equal(t, `{"hero":{"id":1}}`, string(existing.Body))
+			}
+
+			// Released keys can be reserved again
+			assert.NoError(t, models.Idempotency.Release(ctx, "bob", "key-1"))
+			existing, err = models.Idempotency.Reserve(ctx, &other)
+			assert.NoError(t, err)
+			assert.Nil(t, existing)
+
+			// Responses cannot be stored once the reservation is lost
+			assert.NoError(t, models.Idempotency.Release(ctx, "bob", "key-1"))
+			other.Status = 201
+			err = models.Idempotency.Complete(ctx, &other)
+			assert.ErrorIs(t, err, ErrRecordNotFound)
+
+			// Expired records are replaced
+			expired := &IdempotencyRecord{Subject: "alice", Key: "key-2", Fingerprint: "a", ExpiresAt: time.Now()}
+			_, err = models.Idempotency.Reserve(ctx, expired)
+			assert.NoError(t, err)
+
+			expired.Fingerprint = "b"
+			expired.ExpiresAt = time.Now().Add(time.Minute)
+			existing, err = models.Idempotency.Reserve(ctx, expired)
+			assert.NoError(t, err)
+			assert.Nil(t, existing)
+		})
+	}
+}
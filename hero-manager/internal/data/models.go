@@ -1,29 +1,152 @@
 package data
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"time"
 )
 
-// Error returned when looking up a hero that doesn't exist in our database.
 var (
+	// Error returned when looking up a hero that doesn't exist in our database.
 	ErrRecordNotFound = errors.New("record not found")
+
+	// Error returned when updating a hero whose version has changed since it was read.
+	ErrEditConflict = errors.New("edit conflict")
 )
 
+// HeroesRepository stores heroes. All methods abort when ctx is cancelled,
+// e.g. because the client has closed the connection.
+//
+// Delete only marks a hero as deleted. Get, Update and Delete treat deleted
+// heroes as not found, GetAll skips them unless asked for. Deleted heroes
+// can be restored until they are purged. Delete and Purge also remove the
+// hero from all teams and rivalries, Restore does not bring them back.
 type HeroesRepository interface {
-	Insert(hero *Hero) error
-	Get(id int64) (*Hero, error)
-	Update(hero *Hero) error
-	Delete(id int64) error
-	GetAll(name string, abilities []string, filters Filters) ([]*Hero, error)
+	Insert(ctx context.Context, hero *Hero) error
+	InsertMany(ctx context.Context, heroes []*Hero) error
+	Get(ctx context.Context, id int64) (*Hero, error)
+	Update(ctx context.Context, hero *Hero) error
+	Delete(ctx context.Context, id int64) error
+	Restore(ctx context.Context, id int64) (*Hero, error)
+	Purge(ctx context.Context, id int64) error
+	GetAll(ctx context.Context, heroFilter HeroFilter, filters Filters) ([]*Hero, Metadata, error)
+	Stream(ctx context.Context, heroFilter HeroFilter, filters Filters, fn func(*Hero) error) error
+
+	// History returns the audit events of a hero. Insert, Update and Delete
+	// record them together with the change. They also add the Event
+	// publishing the change to the outbox, see OutboxRepository.
+	History(ctx context.Context, heroID int64, filters Filters) ([]*AuditEvent, Metadata, error)
+
+	// Rivalries are symmetric. AddRival is a no-op if the heroes already are
+	// rivals, it returns ErrRecordNotFound if one of them does not exist or
+	// has been deleted. Rivals returns the rivals of a hero sorted by name.
+	AddRival(ctx context.Context, heroID, rivalID int64) error
+	RemoveRival(ctx context.Context, heroID, rivalID int64) error
+	Rivals(ctx context.Context, heroID int64) ([]*Hero, error)
+}
+
+// TeamsRepository stores teams and their members. Heroes can be members of
+// any number of teams. Deleting a team removes all of its memberships.
+//
+// AddMember is a no-op if the hero already is a member, it returns
+// ErrRecordNotFound if the team or the hero does not exist or the hero has
+// been deleted. Members and TeamsOf return their results sorted by name.
+type TeamsRepository interface {
+	Insert(ctx context.Context, team *Team) error
+	Get(ctx context.Context, id int64) (*Team, error)
+	Update(ctx context.Context, team *Team) error
+	Delete(ctx context.Context, id int64) error
+	GetAll(ctx context.Context, filters Filters) ([]*Team, Metadata, error)
+	AddMember(ctx context.Context, teamID, heroID int64) error
+	RemoveMember(ctx context.Context, teamID, heroID int64) error
+	Members(ctx context.Context, teamID int64) ([]*Hero, error)
+	TeamsOf(ctx context.Context, heroID int64) ([]*Team, error)
+}
+
+// OutboxRepository gives access to the events that HeroesRepository adds
+// to the outbox together with every change of a hero. Claim returns up to
+// limit due events, oldest first, and hides them from further claims for
+// lease. Published removes an event, Retry makes it due again after delay.
+// Claimed events that are neither published nor retried are claimed again
+// once their lease has expired, so every event is published at least once,
+// even if the process publishing it crashes.
+type OutboxRepository interface {
+	Claim(ctx context.Context, limit int, lease time.Duration) ([]*Event, error)
+	Published(ctx context.Context, id int64) error
+	Retry(ctx context.Context, id int64, delay time.Duration, reason string) error
+}
+
+// IdempotencyRepository stores the responses of requests carrying an
+// Idempotency-Key. Reserve stores record as in progress unless an unexpired
+// record with the same subject and key exists, which it returns instead.
+// Complete stores the response of a reserved record, it returns
+// ErrRecordNotFound if the reservation has been lost. Release removes a
+// reservation, so that the request can be retried. Records are removed once
+// they have expired.
+type IdempotencyRepository interface {
+	Reserve(ctx context.Context, record *IdempotencyRecord) (*IdempotencyRecord, error)
+	Complete(ctx context.Context, record *IdempotencyRecord) error
+	Release(ctx context.Context, subject, key string) error
 }
 
 type Models struct {
-	Heroes HeroesRepository
+	Heroes      HeroesRepository
+	Teams       TeamsRepository
+	Outbox      OutboxRepository
+	Idempotency IdempotencyRepository
+}
+
+// NewModels creates models backed by PostgreSQL. Every query is cancelled
+// after queryTimeout (no timeout if zero).
+func NewModels(db *sql.DB, queryTimeout time.Duration) Models {
+	return Models{
+		Heroes:      HeroModel{DB: db, QueryTimeout: queryTimeout},
+		Teams:       TeamModel{DB: db, QueryTimeout: queryTimeout},
+		Outbox:      OutboxModel{DB: db, QueryTimeout: queryTimeout},
+		Idempotency: IdempotencyModel{DB: db, QueryTimeout: queryTimeout},
+	}
 }
 
-func NewModels(db *sql.DB) Models {
+// NewSQLiteModels creates models backed by SQLite. The schema must have been
+// created with CreateSQLiteSchema.
+func NewSQLiteModels(db *sql.DB, queryTimeout time.Duration) Models {
 	return Models{
-		Heroes: HeroModel{DB: db},
+		Heroes:      SQLiteHeroModel{DB: db, QueryTimeout: queryTimeout},
+		Teams:       SQLiteTeamModel{TeamModel{DB: db, QueryTimeout: queryTimeout}},
+		Outbox:      SQLiteOutboxModel{OutboxModel{DB: db, QueryTimeout: queryTimeout}},
+		Idempotency: SQLiteIdempotencyModel{IdempotencyModel{DB: db, QueryTimeout: queryTimeout}},
 	}
 }
+
+// NewMemoryModels creates models keeping all data in memory.
+func NewMemoryModels() Models {
+	heroes := NewMemoryHeroModel()
+	return Models{
+		Heroes:      heroes,
+		Teams:       NewMemoryTeamModel(heroes),
+		Outbox:      NewMemoryOutboxModel(heroes),
+		Idempotency: NewMemoryIdempotencyModel(),
+	}
+}
+
+// withQueryTimeout derives the context for a single database operation.
+func withQueryTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, timeout)
+}
+
+// contextError returns the context's error if ctx has been cancelled or its
+// deadline has exceeded. Database drivers do not report these cases
+// consistently (e.g. lib/pq returns "canceling statement due to user request").
+func contextError(ctx context.Context, err error) error {
+	if err != nil && ctx.Err() != nil {
+		return fmt.Errorf("%w: %v", ctx.Err(), err)
+	}
+
+	return err
+}
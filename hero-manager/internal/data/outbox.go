@@ -0,0 +1,175 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+const (
+	EventHeroCreated = "hero.created"
+	EventHeroUpdated = "hero.updated"
+	EventHeroDeleted = "hero.deleted"
+)
+
+// eventTypes maps audit actions to the types of the events they publish.
+// Restoring a hero updates it. Purging a soft deleted hero publishes
+// hero.deleted a second time, consumers handle it like any duplicate.
+var eventTypes = map[string]string{
+	AuditActionCreate:  EventHeroCreated,
+	AuditActionUpdate:  EventHeroUpdated,
+	AuditActionRestore: EventHeroUpdated,
+	AuditActionDelete:  EventHeroDeleted,
+	AuditActionPurge:   EventHeroDeleted,
+}
+
+// Event notifies other services of a change of a hero. Events are stored in
+// the outbox within the transaction changing the hero and published
+// afterwards, at least once. Consumers recognize duplicates by ID. Failed
+// events are retried later, so events of a hero can arrive out of order and
+// consumers should ignore events with an older Version than they have seen.
+type Event struct {
+	ID      int64  `json:"id"`
+	Type    string `json:"type"`
+	HeroID  int64  `json:"heroId"`
+	Version int32  `json:"version"`
+	Actor   string `json:"actor"`
+
+	// The hero after the change (before it for purged heroes) with the
+	// fields of audit events plus id and version. Abilities are an array.
+	Hero       json.RawMessage `json:"hero"`
+	OccurredAt time.Time       `json:"occurredAt"`
+
+	// Number of times the event has been claimed for publishing
+	Attempts int `json:"-"`
+}
+
+// newOutboxEvent creates the event publishing the change recorded by an
+// audit event.
+func newOutboxEvent(audit *AuditEvent, hero *Hero) (*Event, error) {
+	fields := heroFields(hero)
+	fields["id"] = hero.ID
+	fields["version"] = hero.Version
+
+	payload, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Event{
+		Type:       eventTypes[audit.Action],
+		HeroID:     audit.HeroID,
+		Version:    audit.Version,
+		Actor:      audit.Actor,
+		Hero:       payload,
+		OccurredAt: audit.CreatedAt,
+	}, nil
+}
+
+// writeOutboxEvent stores the event publishing the change recorded by an
+// audit event within the transaction changing the hero. It is called right
+// after writeAuditEvent.
+func writeOutboxEvent(ctx context.Context, tx *sql.Tx, createdAt interface{}, audit *AuditEvent, hero *Hero) error {
+	event, err := newOutboxEvent(audit, hero)
+	if err != nil {
+		return err
+	}
+
+	query := `
+        INSERT INTO outbox (type, hero_id, version, actor, payload, created_at)
+        VALUES ($1, $2, $3, $4, $5, $6)`
+
+	args := []interface{}{event.Type, event.HeroID, event.Version, event.Actor, string(event.Hero), createdAt}
+	_, err = tx.ExecContext(ctx, query, args...)
+	return err
+}
+
+// OutboxModel is an OutboxRepository for the outbox of HeroModel.
+type OutboxModel struct {
+	DB           *sql.DB
+	QueryTimeout time.Duration
+}
+
+// Claim locks the claimed rows with SKIP LOCKED, so that concurrent
+// dispatchers (e.g. of several server instances) claim different events.
+func (m OutboxModel) Claim(ctx context.Context, limit int, lease time.Duration) ([]*Event, error) {
+	ctx, cancel := withQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	query := `
+        UPDATE outbox
+        SET attempts = attempts + 1, next_attempt_at = NOW() + make_interval(secs => $2)
+        WHERE id IN (
+            SELECT id
+            FROM outbox
+            WHERE next_attempt_at <= NOW()
+            ORDER BY id
+            LIMIT $1
+            FOR UPDATE SKIP LOCKED)
+        RETURNING id, type, hero_id, version, actor, payload, created_at, attempts`
+
+	rows, err := m.DB.QueryContext(ctx, query, limit, lease.Seconds())
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	defer rows.Close()
+
+	events := []*Event{}
+	for rows.Next() {
+		var event Event
+
+		err := rows.Scan(
+			&event.ID,
+			&event.Type,
+			&event.HeroID,
+			&event.Version,
+			&event.Actor,
+			&event.Hero,
+			&event.OccurredAt,
+			&event.Attempts,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		events = append(events, &event)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	sortEvents(events)
+	return events, nil
+}
+
+// Published deletes an event. The audit events keep the history of heroes.
+func (m OutboxModel) Published(ctx context.Context, id int64) error {
+	ctx, cancel := withQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, "DELETE FROM outbox WHERE id = $1", id)
+	return contextError(ctx, err)
+}
+
+func (m OutboxModel) Retry(ctx context.Context, id int64, delay time.Duration, reason string) error {
+	ctx, cancel := withQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	query := `
+        UPDATE outbox
+        SET next_attempt_at = NOW() + make_interval(secs => $2), last_error = $3
+        WHERE id = $1`
+
+	_, err := m.DB.ExecContext(ctx, query, id, delay.Seconds(), reason)
+	return contextError(ctx, err)
+}
+
+// sortEvents orders events oldest first. RETURNING does not guarantee any
+// order.
+func sortEvents(events []*Event) {
+	sort.Slice(events, func(i, j int) bool { return events[i].ID < events[j].ID })
+}
@@ -0,0 +1,111 @@
+package data
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryOutboxModel is an OutboxRepository for the outbox of a
+// MemoryHeroModel.
+type MemoryOutboxModel struct {
+	mu     sync.Mutex
+	events map[int64]*memoryOutboxEntry
+	nextID int64
+}
+
+type memoryOutboxEntry struct {
+	event       Event
+	nextAttempt time.Time
+	lastError   string
+}
+
+// NewMemoryOutboxModel creates the outbox of heroes. Every change of a hero
+// adds an event.
+func NewMemoryOutboxModel(heroes *MemoryHeroModel) *MemoryOutboxModel {
+	m := &MemoryOutboxModel{events: make(map[int64]*memoryOutboxEntry), nextID: 1}
+
+	heroes.mu.Lock()
+	heroes.outbox = m
+	heroes.mu.Unlock()
+
+	return m
+}
+
+// add stores the event publishing the change recorded by an audit event.
+func (m *MemoryOutboxModel) add(audit *AuditEvent, hero *Hero) {
+	event, err := newOutboxEvent(audit, hero)
+	if err != nil {
+		panic(err) // heroFields only contains values that can be marshaled
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	event.ID = m.nextID
+	m.nextID++
+	m.events[event.ID] = &memoryOutboxEntry{event: *event}
+}
+
+func (m *MemoryOutboxModel) Claim(ctx context.Context, limit int, lease time.Duration) ([]*Event, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	events := []*Event{}
+	for _, entry := range m.events {
+		if entry.nextAttempt.After(now) {
+			continue
+		}
+
+		events = append(events, &entry.event)
+	}
+
+	sortEvents(events)
+	if len(events) > limit {
+		events = events[:limit]
+	}
+
+	for i, event := range events {
+		entry := m.events[event.ID]
+		entry.event.Attempts++
+		entry.nextAttempt = now.Add(lease)
+
+		c := entry.event
+		events[i] = &c
+	}
+
+	return events, nil
+}
+
+func (m *MemoryOutboxModel) Published(ctx context.Context, id int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.events, id)
+	return nil
+}
+
+func (m *MemoryOutboxModel) Retry(ctx context.Context, id int64, delay time.Duration, reason string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if entry, ok := m.events[id]; ok {
+		entry.nextAttempt = time.Now().Add(delay)
+		entry.lastError = reason
+	}
+
+	return nil
+}
@@ -0,0 +1,86 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// SQLiteOutboxModel is an OutboxRepository for the outbox of
+// SQLiteHeroModel. SQLite serializes writes, so claims cannot overlap.
+// next_attempt_at holds Unix milliseconds of the local clock.
+type SQLiteOutboxModel struct {
+	OutboxModel
+}
+
+func (m SQLiteOutboxModel) Claim(ctx context.Context, limit int, lease time.Duration) ([]*Event, error) {
+	ctx, cancel := withQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	query := `
+        UPDATE outbox
+        SET attempts = attempts + 1, next_attempt_at = $2
+        WHERE id IN (
+            SELECT id
+            FROM outbox
+            WHERE next_attempt_at <= $3
+            ORDER BY id
+            LIMIT $1)
+        RETURNING id, type, hero_id, version, actor, payload, created_at, attempts`
+
+	now := time.Now()
+	rows, err := m.DB.QueryContext(ctx, query, limit, now.Add(lease).UnixMilli(), now.UnixMilli())
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	defer rows.Close()
+
+	events := []*Event{}
+	for rows.Next() {
+		var event Event
+		var payload, createdAt string
+
+		err := rows.Scan(
+			&event.ID,
+			&event.Type,
+			&event.HeroID,
+			&event.Version,
+			&event.Actor,
+			&payload,
+			&createdAt,
+			&event.Attempts,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		event.Hero = json.RawMessage(payload)
+		event.OccurredAt, err = time.Parse(sqliteTimeFormat, createdAt)
+		if err != nil {
+			return nil, err
+		}
+
+		events = append(events, &event)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	sortEvents(events)
+	return events, nil
+}
+
+func (m SQLiteOutboxModel) Retry(ctx context.Context, id int64, delay time.Duration, reason string) error {
+	ctx, cancel := withQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	query := `
+        UPDATE outbox
+        SET next_attempt_at = $2, last_error = $3
+        WHERE id = $1`
+
+	_, err := m.DB.ExecContext(ctx, query, id, time.Now().Add(delay).UnixMilli(), reason)
+	return contextError(ctx, err)
+}
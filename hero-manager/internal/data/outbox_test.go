@@ -0,0 +1,91 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func eventTypesOf(events []*Event) []string {
+	types := []string{}
+	for _, event := range events {
+		types = append(types, event.Type)
+	}
+
+	return types
+}
+
+func TestOutbox(t *testing.T) {
+	for name, models := range testModels(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := ContextWithActor(context.Background(), "test-user")
+
+			hero := &Hero{Name: "Superman", Abilities: []string{"strength", "flight"}}
+			err := models.Heroes.Insert(ctx, hero)
+			assert.NoError(t, err)
+
+			hero.RealName = "Clark Kent"
+			err = models.Heroes.Update(ctx, hero)
+			assert.NoError(t, err)
+
+			// Failed changes do not publish anything
+			hero.Version = 1
+			err = models.Heroes.Update(ctx, hero)
+			assert.ErrorIs(t, err, ErrEditConflict)
+
+			assert.NoError(t, models.Heroes.Delete(ctx, hero.ID))
+			_, err = models.Heroes.Restore(ctx, hero.ID)
+			assert.NoError(t, err)
+			assert.NoError(t, models.Heroes.Purge(ctx, hero.ID))
+
+			// The lease of these events expires immediately
+			events, err := models.Outbox.Claim(ctx, 2, 0)
+			assert.NoError(t, err)
+			assert.Equal(t, []string{EventHeroCreated, EventHeroUpdated}, eventTypesOf(events))
+
+			created := events[0]
+			assert.Equal(t, hero.ID, created.HeroID)
+			assert.Equal(t, int32(1), created.Version)
+			assert.Equal(t, "test-user", created.Actor)
+			assert.Equal(t, 1, created.Attempts)
+			assert.False(t, created.OccurredAt.IsZero())
+
+			var payload struct {
+				ID        int64    `json:"id"`
+				Name      string   `json:"name"`
+				Abilities []string `json:"abilities"`
+			}
+			err = json.Unmarshal(created.Hero, &payload)
+			assert.NoError(t, err)
+			assert.Equal(t, hero.ID, payload.ID)
+			assert.Equal(t, []string{"strength", "flight"}, payload.Abilities)
+
+			assert.NoError(t, models.Outbox.Published(ctx, created.ID))
+
+			// The unpublished event is claimed again
+			events, err = models.Outbox.Claim(ctx, 10, time.Minute)
+			assert.NoError(t, err)
+			assert.Equal(t, []string{EventHeroUpdated, EventHeroDeleted, EventHeroUpdated, EventHeroDeleted}, eventTypesOf(events))
+			assert.Equal(t, 2, events[0].Attempts)
+
+			// Claimed events are hidden until their lease expires
+			claimed, err := models.Outbox.Claim(ctx, 10, time.Minute)
+			assert.NoError(t, err)
+			assert.Empty(t, claimed)
+
+			assert.NoError(t, models.Outbox.Retry(ctx, events[0].ID, 0, "webhook unavailable"))
+			assert.NoError(t, models.Outbox.Retry(ctx, events[1].ID, time.Hour, "webhook unavailable"))
+			for _, event := range events[2:] {
+				assert.NoError(t, models.Outbox.Published(ctx, event.ID))
+			}
+
+			events, err = models.Outbox.Claim(ctx, 10, time.Minute)
+			assert.NoError(t, err)
+			assert.Equal(t, []string{EventHeroUpdated}, eventTypesOf(events))
+			assert.Equal(t, 3, events[0].Attempts)
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"heroes.rainerstropek.com/internal/validator"
+)
+
+func ValidateRivalry(v *validator.Validator, heroID, rivalID int64) {
+	v.Check(heroID != rivalID, "rivalId", "must not be the hero itself")
+}
+
+// rivalryKey orders the ids of a rivalry, every pair of heroes is stored once.
+func rivalryKey(heroID, rivalID int64) (int64, int64) {
+	return min(heroID, rivalID), max(heroID, rivalID)
+}
+
+// rivalsQuery selects the rivals of a hero. Like memberships, rivalries of
+// deleted heroes are removed when they are deleted.
+const rivalsQuery = `
+        SELECT id, first_seen, name, can_fly, realname, abilities, version, deleted_at
+        FROM heroes
+        WHERE id IN (
+            SELECT rival_id FROM rivalries WHERE hero_id = $1
+            UNION SELECT hero_id FROM rivalries WHERE rival_id = $1)
+        AND deleted_at IS NULL
+        ORDER BY name, id`
+
+// addRival stores a rivalry. Rivalries have the same columns in PostgreSQL
+// and SQLite, so both models share the query.
+func addRival(ctx context.Context, db *sql.DB, timeout time.Duration, heroID, rivalID int64) error {
+	if heroID == rivalID {
+		return ErrRecordNotFound
+	}
+
+	ctx, cancel := withQueryTimeout(ctx, timeout)
+	defer cancel()
+
+	heroID, rivalID = rivalryKey(heroID, rivalID)
+
+	query := `
+        INSERT INTO rivalries (hero_id, rival_id)
+        SELECT hero.id, rival.id
+        FROM heroes AS hero, heroes AS rival
+        WHERE hero.id = $1 AND rival.id = $2 AND hero.deleted_at IS NULL AND rival.deleted_at IS NULL
+        ON CONFLICT DO NOTHING`
+
+	result, err := db.ExecContext(ctx, query, heroID, rivalID)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected > 0 {
+		return nil
+	}
+
+	// Nothing inserted, either the heroes already are rivals or one of them is missing
+	query = `SELECT EXISTS (SELECT 1 FROM rivalries WHERE hero_id = $1 AND rival_id = $2)`
+
+	var rivals bool
+	err = db.QueryRowContext(ctx, query, heroID, rivalID).Scan(&rivals)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	if !rivals {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func removeRival(ctx context.Context, db *sql.DB, timeout time.Duration, heroID, rivalID int64) error {
+	ctx, cancel := withQueryTimeout(ctx, timeout)
+	defer cancel()
+
+	heroID, rivalID = rivalryKey(heroID, rivalID)
+
+	query := `DELETE FROM rivalries WHERE hero_id = $1 AND rival_id = $2`
+
+	result, err := db.ExecContext(ctx, query, heroID, rivalID)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (m HeroModel) AddRival(ctx context.Context, heroID, rivalID int64) error {
+	return addRival(ctx, m.DB, m.QueryTimeout, heroID, rivalID)
+}
+
+func (m HeroModel) RemoveRival(ctx context.Context, heroID, rivalID int64) error {
+	return removeRival(ctx, m.DB, m.QueryTimeout, heroID, rivalID)
+}
+
+func (m HeroModel) Rivals(ctx context.Context, heroID int64) ([]*Hero, error) {
+	ctx, cancel := withQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, rivalsQuery, heroID)
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	return scanHeroes(ctx, rows)
+}
+
+func (m SQLiteHeroModel) AddRival(ctx context.Context, heroID, rivalID int64) error {
+	return addRival(ctx, m.DB, m.QueryTimeout, heroID, rivalID)
+}
+
+func (m SQLiteHeroModel) RemoveRival(ctx context.Context, heroID, rivalID int64) error {
+	return removeRival(ctx, m.DB, m.QueryTimeout, heroID, rivalID)
+}
+
+func (m SQLiteHeroModel) Rivals(ctx context.Context, heroID int64) ([]*Hero, error) {
+	ctx, cancel := withQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, rivalsQuery, heroID)
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	return scanSQLiteHeroes(ctx, rows)
+}
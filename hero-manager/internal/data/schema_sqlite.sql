@@ -0,0 +1,74 @@
+CREATE TABLE IF NOT EXISTS heroes (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    first_seen text NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    name text NOT NULL,
+    can_fly boolean NOT NULL DEFAULT false,
+    realname text NOT NULL DEFAULT '',
+    abilities text NOT NULL CHECK (json_array_length(abilities) BETWEEN 1 AND 5),
+    version integer NOT NULL DEFAULT 1,
+    deleted_at text
+);
+
+CREATE TABLE IF NOT EXISTS audit_events (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    hero_id integer NOT NULL,
+    action text NOT NULL,
+    actor text NOT NULL,
+    version integer NOT NULL,
+    changes text NOT NULL,
+    created_at text NOT NULL
+);
+CREATE INDEX IF NOT EXISTS audit_events_hero_id_idx ON audit_events (hero_id, id);
+
+-- Foreign keys are only enforced if enabled per connection. The models
+-- delete memberships and rivalries of heroes and teams explicitly.
+CREATE TABLE IF NOT EXISTS teams (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    name text NOT NULL,
+    description text NOT NULL DEFAULT '',
+    version integer NOT NULL DEFAULT 1
+);
+
+CREATE TABLE IF NOT EXISTS team_members (
+    team_id integer NOT NULL REFERENCES teams ON DELETE CASCADE,
+    hero_id integer NOT NULL REFERENCES heroes ON DELETE CASCADE,
+    PRIMARY KEY (team_id, hero_id)
+);
+CREATE INDEX IF NOT EXISTS team_members_hero_id_idx ON team_members (hero_id);
+
+CREATE TABLE IF NOT EXISTS rivalries (
+    hero_id integer NOT NULL REFERENCES heroes ON DELETE CASCADE,
+    rival_id integer NOT NULL REFERENCES heroes ON DELETE CASCADE,
+    PRIMARY KEY (hero_id, rival_id),
+    CHECK (hero_id < rival_id)
+);
+CREATE INDEX IF NOT EXISTS rivalries_rival_id_idx ON rivalries (rival_id);
+
+-- next_attempt_at is stored in Unix milliseconds, so that it can be compared
+-- with the time of the dispatcher
+CREATE TABLE IF NOT EXISTS outbox (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    type text NOT NULL,
+    hero_id integer NOT NULL,
+    version integer NOT NULL,
+    actor text NOT NULL,
+    payload text NOT NULL,
+    created_at text NOT NULL,
+    attempts integer NOT NULL DEFAULT 0,
+    next_attempt_at integer NOT NULL DEFAULT 0,
+    last_error text NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS outbox_next_attempt_at_idx ON outbox (next_attempt_at, id);
+
+-- expires_at is stored in Unix milliseconds like next_attempt_at
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    subject text NOT NULL,
+    key text NOT NULL,
+    fingerprint text NOT NULL,
+    status integer NOT NULL DEFAULT 0,
+    header text NOT NULL DEFAULT '{}',
+    body blob NOT NULL DEFAULT '',
+    expires_at integer NOT NULL,
+    PRIMARY KEY (subject, key)
+);
+CREATE INDEX IF NOT EXISTS idempotency_keys_expires_at_idx ON idempotency_keys (expires_at);
@@ -0,0 +1,55 @@
+package data
+
+import (
+	"strings"
+	"unicode"
+)
+
+// searchTokens splits text into lower case words. Like PostgreSQL's simple
+// text search configuration, everything but letters and digits separates
+// words and no stemming is applied.
+func searchTokens(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// searchRank returns the share of the words of a hero's name, real name and
+// abilities that match a word of the query, or 0 if not all query words
+// occur. It is the local counterpart of ts_rank with length normalization
+// used by HeroModel, so the ranks differ, but the order is similar.
+func searchRank(name, realName string, abilities []string, query []string) float64 {
+	document := searchTokens(name + " " + realName + " " + strings.Join(abilities, " "))
+	if len(document) == 0 || len(query) == 0 {
+		return 0
+	}
+
+	counts := make(map[string]int)
+	for _, token := range document {
+		counts[token]++
+	}
+
+	matches := 0
+	for _, token := range uniqueTokens(query) {
+		if counts[token] == 0 {
+			return 0
+		}
+
+		matches += counts[token]
+	}
+
+	return float64(matches) / float64(len(document))
+}
+
+func uniqueTokens(tokens []string) []string {
+	seen := make(map[string]bool)
+	unique := []string{}
+	for _, token := range tokens {
+		if !seen[token] {
+			seen[token] = true
+			unique = append(unique, token)
+		}
+	}
+
+	return unique
+}
@@ -0,0 +1,74 @@
+package data
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"heroes.rainerstropek.com/internal/validator"
+)
+
+func TestSearchTokens(t *testing.T) {
+	assert.Equal(t, []string{"kara", "zor", "el"}, searchTokens("Kara Zor-El"))
+	assert.Equal(t, []string{"x", "ray", "vision"}, searchTokens("  X-Ray, vision!"))
+	assert.Empty(t, searchTokens(" - "))
+}
+
+func TestSearchRank(t *testing.T) {
+	abilities := []string{"strength", "flight"}
+	assert.Equal(t, 0.4, searchRank("Superman", "Clark Kent", abilities, []string{"clark", "strength"}))
+	assert.Equal(t, 0.2, searchRank("Superman", "Clark Kent", abilities, []string{"kent", "kent"}))
+	assert.Zero(t, searchRank("Superman", "Clark Kent", abilities, []string{"clark", "lex"}))
+	assert.Zero(t, searchRank("Superman", "Clark Kent", abilities, []string{}))
+}
+
+func TestValidateHeroFilter(t *testing.T) {
+	v := validator.New()
+	ValidateHeroFilter(v, HeroFilter{}, Filters{Sort: "-relevance"})
+	assert.Contains(t, v.Errors, "sort")
+
+	v = validator.New()
+	ValidateHeroFilter(v, HeroFilter{Q: "kent"}, Filters{Sort: "relevance,name"})
+	assert.True(t, v.Valid())
+}
+
+func TestRepositorySearch(t *testing.T) {
+	for name, repo := range testRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			insertTestHeroes(t, repo)
+
+			filters := Filters{Page: 1, PageSize: 20, Sort: "relevance", SortSafelist: []string{"id", "name", "relevance"}}
+			heroes, metadata, err := repo.GetAll(ctx, HeroFilter{Q: "Strength"}, filters)
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"Superman", "Wonder Woman", "Supergirl"}, heroNames(heroes))
+			assert.Equal(t, 3, metadata.TotalRecords)
+
+			heroes, _, err = repo.GetAll(ctx, HeroFilter{Q: "flight strength"}, filters)
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"Superman", "Supergirl"}, heroNames(heroes))
+
+			heroes, _, err = repo.GetAll(ctx, HeroFilter{Q: "zor-el"}, filters)
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"Supergirl"}, heroNames(heroes))
+
+			heroes, _, err = repo.GetAll(ctx, HeroFilter{Q: "bruce clark"}, filters)
+			assert.NoError(t, err)
+			assert.Empty(t, heroes)
+
+			// Keyset pagination works on relevance like on any other column
+			filters.PageSize = 1
+			names := []string{}
+			for {
+				heroes, metadata, err = repo.GetAll(ctx, HeroFilter{Q: "strength"}, filters)
+				assert.NoError(t, err)
+				names = append(names, heroNames(heroes)...)
+				if metadata.NextCursor == "" {
+					break
+				}
+				filters.Cursor = metadata.NextCursor
+			}
+			assert.Equal(t, []string{"Superman", "Wonder Woman", "Supergirl"}, names)
+		})
+	}
+}
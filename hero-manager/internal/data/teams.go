@@ -0,0 +1,345 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"heroes.rainerstropek.com/internal/validator"
+)
+
+// Team is a group of heroes. Members are managed separately, see
+// TeamsRepository.
+type Team struct {
+	ID          int64  `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Version     int32  `json:"version"`
+}
+
+func ValidateTeam(v *validator.Validator, team *Team) {
+	v.Check(team.Name != "", "name", "must be provided")
+	v.Check(len(team.Name) <= 100, "name", "must not be more than 100 bytes long")
+	v.Check(len(team.Description) <= 1000, "description", "must not be more than 1000 bytes long")
+}
+
+// TeamModel is a TeamsRepository storing teams in PostgreSQL. Teams only
+// have columns that PostgreSQL and SQLite handle alike, so SQLiteTeamModel
+// reuses all queries that do not return heroes.
+type TeamModel struct {
+	DB           *sql.DB
+	QueryTimeout time.Duration
+}
+
+func (m TeamModel) Insert(ctx context.Context, team *Team) error {
+	ctx, cancel := withQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	query := `
+        INSERT INTO teams (name, description)
+        VALUES ($1, $2)
+        RETURNING id, version`
+
+	err := m.DB.QueryRowContext(ctx, query, team.Name, team.Description).Scan(&team.ID, &team.Version)
+	return contextError(ctx, err)
+}
+
+func (m TeamModel) Get(ctx context.Context, id int64) (*Team, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	ctx, cancel := withQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	query := `
+        SELECT id, name, description, version
+        FROM teams
+        WHERE id = $1`
+
+	var team Team
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&team.ID, &team.Name, &team.Description, &team.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, contextError(ctx, err)
+		}
+	}
+
+	return &team, nil
+}
+
+// Update stores a changed team. The team's version must match the stored
+// version.
+func (m TeamModel) Update(ctx context.Context, team *Team) error {
+	ctx, cancel := withQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	query := `
+        UPDATE teams
+        SET name = $1, description = $2, version = version + 1
+        WHERE id = $3 AND version = $4
+        RETURNING version`
+
+	args := []interface{}{team.Name, team.Description, team.ID, team.Version}
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&team.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return contextError(ctx, err)
+		}
+	}
+
+	return nil
+}
+
+// Delete permanently deletes a team and its memberships.
+func (m TeamModel) Delete(ctx context.Context, id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	ctx, cancel := withQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	defer tx.Rollback()
+
+	// PostgreSQL would cascade, SQLite does not enforce foreign keys
+	_, err = tx.ExecContext(ctx, "DELETE FROM team_members WHERE team_id = $1", id)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	result, err := tx.ExecContext(ctx, "DELETE FROM teams WHERE id = $1", id)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return contextError(ctx, tx.Commit())
+}
+
+// GetAll returns a page of teams. Cursors are not supported.
+func (m TeamModel) GetAll(ctx context.Context, filters Filters) ([]*Team, Metadata, error) {
+	ctx, cancel := withQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	query := fmt.Sprintf(`
+        SELECT count(*) OVER(), id, name, description, version
+        FROM teams
+        ORDER BY %s
+        LIMIT $1 OFFSET $2`, filters.orderBy())
+
+	rows, err := m.DB.QueryContext(ctx, query, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, contextError(ctx, err)
+	}
+
+	defer rows.Close()
+
+	totalRecords := 0
+	teams := []*Team{}
+
+	for rows.Next() {
+		var team Team
+
+		err := rows.Scan(&totalRecords, &team.ID, &team.Name, &team.Description, &team.Version)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		teams = append(teams, &team)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, contextError(ctx, err)
+	}
+
+	if filters.pastLastPage(len(teams)) {
+		totalRecords, err = countRows(ctx, m.DB, "SELECT id FROM teams")
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+	}
+
+	return teams, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+// AddMember adds a hero to a team. Nothing is inserted unless both exist
+// and the hero has not been deleted.
+func (m TeamModel) AddMember(ctx context.Context, teamID, heroID int64) error {
+	ctx, cancel := withQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	query := `
+        INSERT INTO team_members (team_id, hero_id)
+        SELECT teams.id, heroes.id
+        FROM teams, heroes
+        WHERE teams.id = $1 AND heroes.id = $2 AND heroes.deleted_at IS NULL
+        ON CONFLICT DO NOTHING`
+
+	result, err := m.DB.ExecContext(ctx, query, teamID, heroID)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected > 0 {
+		return nil
+	}
+
+	// Nothing inserted, either the hero already is a member or one of them is missing
+	query = `SELECT EXISTS (SELECT 1 FROM team_members WHERE team_id = $1 AND hero_id = $2)`
+
+	var member bool
+	err = m.DB.QueryRowContext(ctx, query, teamID, heroID).Scan(&member)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	if !member {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (m TeamModel) RemoveMember(ctx context.Context, teamID, heroID int64) error {
+	ctx, cancel := withQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	query := `DELETE FROM team_members WHERE team_id = $1 AND hero_id = $2`
+
+	result, err := m.DB.ExecContext(ctx, query, teamID, heroID)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// membersQuery selects the heroes of a team. Memberships of deleted heroes
+// are removed when they are deleted, the condition on deleted_at only hides
+// heroes deleted concurrently with being added.
+const membersQuery = `
+        SELECT heroes.id, first_seen, name, can_fly, realname, abilities, version, deleted_at
+        FROM heroes JOIN team_members ON team_members.hero_id = heroes.id
+        WHERE team_members.team_id = $1 AND deleted_at IS NULL
+        ORDER BY name, heroes.id`
+
+func (m TeamModel) Members(ctx context.Context, teamID int64) ([]*Hero, error) {
+	ctx, cancel := withQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, membersQuery, teamID)
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	return scanHeroes(ctx, rows)
+}
+
+// scanHeroes reads all heroes of rows and closes them.
+func scanHeroes(ctx context.Context, rows *sql.Rows) ([]*Hero, error) {
+	defer rows.Close()
+
+	heroes := []*Hero{}
+	for rows.Next() {
+		var hero Hero
+
+		err := rows.Scan(heroDest(&hero)...)
+		if err != nil {
+			return nil, err
+		}
+
+		heroes = append(heroes, &hero)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	return heroes, nil
+}
+
+func (m TeamModel) TeamsOf(ctx context.Context, heroID int64) ([]*Team, error) {
+	ctx, cancel := withQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	query := `
+        SELECT teams.id, name, description, version
+        FROM teams JOIN team_members ON team_members.team_id = teams.id
+        WHERE team_members.hero_id = $1
+        ORDER BY name, teams.id`
+
+	rows, err := m.DB.QueryContext(ctx, query, heroID)
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	defer rows.Close()
+
+	teams := []*Team{}
+	for rows.Next() {
+		var team Team
+
+		err := rows.Scan(&team.ID, &team.Name, &team.Description, &team.Version)
+		if err != nil {
+			return nil, err
+		}
+
+		teams = append(teams, &team)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	return teams, nil
+}
+
+// deleteHeroRelations removes a hero from all teams and rivalries within the
+// transaction deleting the hero.
+func deleteHeroRelations(ctx context.Context, tx *sql.Tx, heroID int64) error {
+	_, err := tx.ExecContext(ctx, "DELETE FROM team_members WHERE hero_id = $1", heroID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM rivalries WHERE hero_id = $1 OR rival_id = $1", heroID)
+	return err
+}
@@ -0,0 +1,249 @@
+package data
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// MemoryTeamModel is a TeamsRepository keeping all teams in memory. Members
+// are looked up in the MemoryHeroModel the teams belong to.
+type MemoryTeamModel struct {
+	heroes  *MemoryHeroModel
+	mu      sync.RWMutex
+	teams   map[int64]*Team
+	members map[int64]map[int64]bool // hero ids by team id
+	nextID  int64
+}
+
+// NewMemoryTeamModel creates the teams of heroes. Heroes deleted from heroes
+// are removed from the teams.
+func NewMemoryTeamModel(heroes *MemoryHeroModel) *MemoryTeamModel {
+	m := &MemoryTeamModel{
+		heroes:  heroes,
+		teams:   make(map[int64]*Team),
+		members: make(map[int64]map[int64]bool),
+		nextID:  1,
+	}
+
+	heroes.mu.Lock()
+	heroes.teams = m
+	heroes.mu.Unlock()
+
+	return m
+}
+
+func (m *MemoryTeamModel) Insert(ctx context.Context, team *Team) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	team.ID = m.nextID
+	team.Version = 1
+	m.nextID++
+
+	c := *team
+	m.teams[team.ID] = &c
+	m.members[team.ID] = make(map[int64]bool)
+
+	return nil
+}
+
+func (m *MemoryTeamModel) Get(ctx context.Context, id int64) (*Team, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	team, ok := m.teams[id]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+
+	c := *team
+	return &c, nil
+}
+
+func (m *MemoryTeamModel) Update(ctx context.Context, team *Team) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.teams[team.ID]
+	if !ok || stored.Version != team.Version {
+		return ErrEditConflict
+	}
+
+	team.Version++
+	c := *team
+	m.teams[team.ID] = &c
+
+	return nil
+}
+
+func (m *MemoryTeamModel) Delete(ctx context.Context, id int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.teams[id]; !ok {
+		return ErrRecordNotFound
+	}
+
+	delete(m.teams, id)
+	delete(m.members, id)
+
+	return nil
+}
+
+func (m *MemoryTeamModel) GetAll(ctx context.Context, filters Filters) ([]*Team, Metadata, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	m.mu.RLock()
+	teams := []*Team{}
+	for _, team := range m.teams {
+		c := *team
+		teams = append(teams, &c)
+	}
+	m.mu.RUnlock()
+
+	keys := filters.sortKeys()
+	slices.SortFunc(teams, func(a, b *Team) int {
+		for _, key := range keys {
+			var c int
+			switch key.Column {
+			case "id":
+				c = cmp.Compare(a.ID, b.ID)
+			case "name":
+				c = strings.Compare(a.Name, b.Name)
+			}
+
+			if key.Descending {
+				c = -c
+			}
+
+			if c != 0 {
+				return c
+			}
+		}
+
+		return 0
+	})
+
+	totalRecords := len(teams)
+	teams = teams[min(filters.offset(), len(teams)):]
+	teams = teams[:min(filters.limit(), len(teams))]
+
+	return teams, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+func (m *MemoryTeamModel) AddMember(ctx context.Context, teamID, heroID int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.heroes.mu.RLock()
+	defer m.heroes.mu.RUnlock()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, heroOK := m.heroes.active(heroID)
+	members, teamOK := m.members[teamID]
+	if !heroOK || !teamOK {
+		return ErrRecordNotFound
+	}
+
+	members[heroID] = true
+
+	return nil
+}
+
+func (m *MemoryTeamModel) RemoveMember(ctx context.Context, teamID, heroID int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.members[teamID][heroID] {
+		return ErrRecordNotFound
+	}
+
+	delete(m.members[teamID], heroID)
+
+	return nil
+}
+
+func (m *MemoryTeamModel) Members(ctx context.Context, teamID int64) ([]*Hero, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.heroes.mu.RLock()
+	defer m.heroes.mu.RUnlock()
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	heroes := []*Hero{}
+	for heroID := range m.members[teamID] {
+		if hero, ok := m.heroes.active(heroID); ok {
+			heroes = append(heroes, copyHero(hero))
+		}
+	}
+
+	sortHeroesByName(heroes)
+
+	return heroes, nil
+}
+
+func (m *MemoryTeamModel) TeamsOf(ctx context.Context, heroID int64) ([]*Team, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	teams := []*Team{}
+	for teamID, members := range m.members {
+		if members[heroID] {
+			c := *m.teams[teamID]
+			teams = append(teams, &c)
+		}
+	}
+
+	slices.SortFunc(teams, func(a, b *Team) int {
+		return cmp.Or(strings.Compare(a.Name, b.Name), cmp.Compare(a.ID, b.ID))
+	})
+
+	return teams, nil
+}
+
+// removeHero deletes all memberships of a hero. It is called by the
+// MemoryHeroModel while holding its write lock.
+func (m *MemoryTeamModel) removeHero(heroID int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, members := range m.members {
+		delete(members, heroID)
+	}
+}
@@ -0,0 +1,52 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+)
+
+// SQLiteTeamModel is a TeamsRepository storing teams in an embedded SQLite
+// database. Only the queries returning heroes differ from TeamModel.
+type SQLiteTeamModel struct {
+	TeamModel
+}
+
+func (m SQLiteTeamModel) Members(ctx context.Context, teamID int64) ([]*Hero, error) {
+	ctx, cancel := withQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, membersQuery, teamID)
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	return scanSQLiteHeroes(ctx, rows)
+}
+
+// scanSQLiteHeroes reads all heroes of rows and closes them.
+func scanSQLiteHeroes(ctx context.Context, rows *sql.Rows) ([]*Hero, error) {
+	defer rows.Close()
+
+	heroes := []*Hero{}
+	for rows.Next() {
+		var s sqliteHeroScanner
+
+		err := rows.Scan(s.dest()...)
+		if err != nil {
+			return nil, err
+		}
+
+		hero, err := s.result()
+		if err != nil {
+			return nil, err
+		}
+
+		heroes = append(heroes, hero)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	return heroes, nil
+}
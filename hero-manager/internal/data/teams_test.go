@@ -0,0 +1,203 @@
+package data
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testModels returns all models that can run without an external database
+// server.
+func testModels(t *testing.T) map[string]Models {
+	return map[string]Models{
+		"memory": NewMemoryModels(),
+		"sqlite": NewSQLiteModels(openTestDB(t), 0),
+	}
+}
+
+func teamNames(teams []*Team) []string {
+	names := []string{}
+	for _, team := range teams {
+		names = append(names, team.Name)
+	}
+
+	return names
+}
+
+func TestTeamsCRUD(t *testing.T) {
+	for name, models := range testModels(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			for _, name := range []string{"Justice League", "Avengers", "Teen Titans"} {
+				err := models.Teams.Insert(ctx, &Team{Name: name})
+				assert.NoError(t, err)
+			}
+
+			team, err := models.Teams.Get(ctx, 1)
+			assert.NoError(t, err)
+			assert.Equal(t, int32(1), team.Version)
+
+			team.Description = "Founded in 1960"
+			err = models.Teams.Update(ctx, team)
+			assert.NoError(t, err)
+			assert.Equal(t, int32(2), team.Version)
+
+			team.Version = 1
+			err = models.Teams.Update(ctx, team)
+			assert.ErrorIs(t, err, ErrEditConflict)
+
+			filters := Filters{Page: 1, PageSize: 2, Sort: "name", SortSafelist: []string{"id", "name"}}
+			teams, metadata, err := models.Teams.GetAll(ctx, filters)
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"Avengers", "Justice League"}, teamNames(teams))
+			assert.Equal(t, 3, metadata.TotalRecords)
+			assert.Equal(t, "Founded in 1960", teams[1].Description)
+
+			filters.Page = 3
+			teams, metadata, err = models.Teams.GetAll(ctx, filters)
+			assert.NoError(t, err)
+			assert.Empty(t, teams)
+			assert.Equal(t, 2, metadata.LastPage)
+			assert.Equal(t, 3, metadata.TotalRecords)
+
+			err = models.Teams.Delete(ctx, 1)
+			assert.NoError(t, err)
+
+			_, err = models.Teams.Get(ctx, 1)
+			assert.ErrorIs(t, err, ErrRecordNotFound)
+
+			err = models.Teams.Delete(ctx, 1)
+			assert.ErrorIs(t, err, ErrRecordNotFound)
+		})
+	}
+}
+
+func TestTeamMembers(t *testing.T) {
+	for name, models := range testModels(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			insertTestHeroes(t, models.Heroes)
+
+			justiceLeague := &Team{Name: "Justice League"}
+			superFamily := &Team{Name: "Super Family"}
+			for _, team := range []*Team{justiceLeague, superFamily} {
+				err := models.Teams.Insert(ctx, team)
+				assert.NoError(t, err)
+			}
+
+			for _, heroID := range []int64{1, 2, 3} {
+				err := models.Teams.AddMember(ctx, justiceLeague.ID, heroID)
+				assert.NoError(t, err)
+			}
+
+			// Adding a member twice is fine
+			for _, heroID := range []int64{1, 4, 4} {
+				err := models.Teams.AddMember(ctx, superFamily.ID, heroID)
+				assert.NoError(t, err)
+			}
+
+			err := models.Teams.AddMember(ctx, justiceLeague.ID, 42)
+			assert.ErrorIs(t, err, ErrRecordNotFound)
+
+			err = models.Teams.AddMember(ctx, 42, 1)
+			assert.ErrorIs(t, err, ErrRecordNotFound)
+
+			members, err := models.Teams.Members(ctx, justiceLeague.ID)
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"Batman", "Superman", "Wonder Woman"}, heroNames(members))
+
+			teams, err := models.Teams.TeamsOf(ctx, 1)
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"Justice League", "Super Family"}, teamNames(teams))
+
+			err = models.Teams.RemoveMember(ctx, justiceLeague.ID, 3)
+			assert.NoError(t, err)
+
+			err = models.Teams.RemoveMember(ctx, justiceLeague.ID, 3)
+			assert.ErrorIs(t, err, ErrRecordNotFound)
+
+			// Deleting heroes removes their memberships, restoring does not bring them back
+			err = models.Heroes.Delete(ctx, 1)
+			assert.NoError(t, err)
+
+			_, err = models.Heroes.Restore(ctx, 1)
+			assert.NoError(t, err)
+
+			teams, err = models.Teams.TeamsOf(ctx, 1)
+			assert.NoError(t, err)
+			assert.Empty(t, teams)
+
+			err = models.Heroes.Purge(ctx, 4)
+			assert.NoError(t, err)
+
+			members, err = models.Teams.Members(ctx, superFamily.ID)
+			assert.NoError(t, err)
+			assert.Empty(t, members)
+
+			// Deleted heroes cannot join teams
+			err = models.Heroes.Delete(ctx, 2)
+			assert.NoError(t, err)
+
+			err = models.Teams.AddMember(ctx, superFamily.ID, 2)
+			assert.ErrorIs(t, err, ErrRecordNotFound)
+
+			// Deleting teams removes their memberships
+			err = models.Teams.AddMember(ctx, superFamily.ID, 3)
+			assert.NoError(t, err)
+
+			err = models.Teams.Delete(ctx, superFamily.ID)
+			assert.NoError(t, err)
+
+			teams, err = models.Teams.TeamsOf(ctx, 3)
+			assert.NoError(t, err)
+			assert.Empty(t, teams)
+		})
+	}
+}
+
+func TestRivalries(t *testing.T) {
+	for name, repo := range testRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			insertTestHeroes(t, repo)
+
+			for _, rivalID := range []int64{2, 3, 3} {
+				err := repo.AddRival(ctx, 1, rivalID)
+				assert.NoError(t, err)
+			}
+
+			// Rivalries are symmetric
+			err := repo.AddRival(ctx, 2, 1)
+			assert.NoError(t, err)
+
+			err = repo.AddRival(ctx, 1, 1)
+			assert.ErrorIs(t, err, ErrRecordNotFound)
+
+			err = repo.AddRival(ctx, 1, 42)
+			assert.ErrorIs(t, err, ErrRecordNotFound)
+
+			rivals, err := repo.Rivals(ctx, 1)
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"Batman", "Wonder Woman"}, heroNames(rivals))
+
+			rivals, err = repo.Rivals(ctx, 3)
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"Superman"}, heroNames(rivals))
+
+			err = repo.RemoveRival(ctx, 3, 1)
+			assert.NoError(t, err)
+
+			err = repo.RemoveRival(ctx, 3, 1)
+			assert.ErrorIs(t, err, ErrRecordNotFound)
+
+			err = repo.Delete(ctx, 2)
+			assert.NoError(t, err)
+
+			rivals, err = repo.Rivals(ctx, 1)
+			assert.NoError(t, err)
+			assert.Empty(t, rivals)
+		})
+	}
+}
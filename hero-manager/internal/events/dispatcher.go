@@ -0,0 +1,124 @@
+package events
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog"
+	"heroes.rainerstropek.com/internal/data"
+)
+
+// Dispatcher publishes the events of the outbox in the background. Events
+// that cannot be published are retried with exponential backoff. If the
+// process stops before an event has been marked as published, it is claimed
+// again once its lease has expired.
+type Dispatcher struct {
+	Outbox    data.OutboxRepository
+	Publisher EventPublisher
+	Logger    *zerolog.Logger
+
+	// Number of events claimed at once. Lease must be long enough to publish
+	// all of them, otherwise they are published twice.
+	BatchSize      int
+	Lease          time.Duration
+	PublishTimeout time.Duration
+
+	// Time to wait for new events once the outbox is empty
+	PollInterval time.Duration
+
+	// Delay of the first retry, doubled for every further attempt
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+func NewDispatcher(outbox data.OutboxRepository, publisher EventPublisher, logger *zerolog.Logger) *Dispatcher {
+	return &Dispatcher{
+		Outbox:         outbox,
+		Publisher:      publisher,
+		Logger:         logger,
+		BatchSize:      10,
+		Lease:          2 * time.Minute,
+		PublishTimeout: 10 * time.Second,
+		PollInterval:   time.Second,
+		MinBackoff:     time.Second,
+		MaxBackoff:     5 * time.Minute,
+	}
+}
+
+// Run publishes events until ctx is cancelled.
+func (d *Dispatcher) Run(ctx context.Context) {
+	for {
+		n, err := d.DispatchOnce(ctx)
+		if err != nil && ctx.Err() == nil {
+			d.Logger.Error().Err(err).Msg("cannot dispatch events")
+		}
+
+		// A full batch indicates that more events are waiting
+		if err == nil && n == d.BatchSize {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(d.PollInterval):
+		}
+	}
+}
+
+// DispatchOnce claims a batch of events and publishes them in order. It
+// returns the number of claimed events.
+func (d *Dispatcher) DispatchOnce(ctx context.Context) (int, error) {
+	events, err := d.Outbox.Claim(ctx, d.BatchSize, d.Lease)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, event := range events {
+		err = d.publish(ctx, event)
+		if err != nil {
+			return len(events), err
+		}
+	}
+
+	return len(events), nil
+}
+
+// publish publishes a single event and records the outcome. Only errors
+// recording the outcome are returned, the event is claimed again after its
+// lease in that case.
+func (d *Dispatcher) publish(ctx context.Context, event *data.Event) error {
+	publishCtx, cancel := context.WithTimeout(ctx, d.PublishTimeout)
+	err := d.Publisher.Publish(publishCtx, event)
+	cancel()
+
+	if err == nil {
+		return d.Outbox.Published(ctx, event.ID)
+	}
+
+	// Leave events to expiring leases when shutting down
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	delay := d.backoff(event.Attempts)
+	d.Logger.Warn().Err(err).
+		Int64("event_id", event.ID).
+		Str("event_type", event.Type).
+		Int("attempts", event.Attempts).
+		Dur("retry_in", delay).
+		Msg("cannot publish event")
+
+	return d.Outbox.Retry(ctx, event.ID, delay, err.Error())
+}
+
+// backoff returns the delay before the next attempt to publish an event that
+// has failed attempts times.
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.MinBackoff
+	for i := 1; i < attempts && delay < d.MaxBackoff; i++ {
+		delay *= 2
+	}
+
+	return min(delay, d.MaxBackoff)
+}
@@ -0,0 +1,135 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"heroes.rainerstropek.com/internal/data"
+)
+
+func newTestDispatcher(models data.Models, publisher EventPublisher) *Dispatcher {
+	logger := zerolog.Nop()
+	d := NewDispatcher(models.Outbox, publisher, &logger)
+	d.PollInterval = time.Millisecond
+	d.MinBackoff = time.Millisecond
+	d.MaxBackoff = 4 * time.Millisecond
+	return d
+}
+
+func TestDispatcherRetriesFailedEvents(t *testing.T) {
+	models := data.NewMemoryModels()
+	ctx := context.Background()
+
+	for _, name := range []string{"Superman", "Batman"} {
+		err := models.Heroes.Insert(ctx, &data.Hero{Name: name, Abilities: []string{"x"}})
+		assert.NoError(t, err)
+	}
+
+	// The first attempt to publish each event fails
+	var mu sync.Mutex
+	attempts := make(map[int64]int)
+	published := []int64{}
+
+	publisher := NewInProcessPublisher()
+	publisher.Subscribe(func(ctx context.Context, event *data.Event) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		attempts[event.ID]++
+		if attempts[event.ID] == 1 {
+			return errors.New("temporarily unavailable")
+		}
+
+		published = append(published, event.HeroID)
+		return nil
+	})
+
+	d := newTestDispatcher(models, publisher)
+
+	n, err := d.DispatchOnce(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Empty(t, published)
+
+	assert.Eventually(t, func() bool {
+		_, err := d.DispatchOnce(ctx)
+		assert.NoError(t, err)
+
+		mu.Lock()
+		defer mu.Unlock()
+		return len(published) == 2
+	}, time.Second, time.Millisecond)
+
+	assert.ElementsMatch(t, []int64{1, 2}, published)
+
+	// Published events are removed from the outbox
+	events, err := models.Outbox.Claim(ctx, 10, 0)
+	assert.NoError(t, err)
+	assert.Empty(t, events)
+}
+
+func TestDispatcherPublishesToWebhook(t *testing.T) {
+	models := data.NewMemoryModels()
+	secret := []byte("s3cr3t")
+
+	received := make(chan data.Event, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !VerifySignature(secret, body, r.Header.Get(HeaderSignature)) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var event data.Event
+		if err := json.Unmarshal(body, &event); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		received <- event
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		newTestDispatcher(models, NewWebhookPublisher(ts.URL, secret)).Run(ctx)
+		close(done)
+	}()
+
+	hero := &data.Hero{Name: "Superman", Abilities: []string{"x"}}
+	assert.NoError(t, models.Heroes.Insert(ctx, hero))
+	assert.NoError(t, models.Heroes.Delete(ctx, hero.ID))
+
+	for _, eventType := range []string{data.EventHeroCreated, data.EventHeroDeleted} {
+		select {
+		case event := <-received:
+			assert.Equal(t, eventType, event.Type)
+			assert.Equal(t, hero.ID, event.HeroID)
+		case <-time.After(time.Second):
+			t.Fatalf("%s has not been published", eventType)
+		}
+	}
+
+	cancel()
+	<-done
+}
+
+func TestBackoff(t *testing.T) {
+	d := &Dispatcher{MinBackoff: time.Second, MaxBackoff: 5 * time.Second}
+
+	assert.Equal(t, time.Second, d.backoff(1))
+	assert.Equal(t, 2*time.Second, d.backoff(2))
+	assert.Equal(t, 4*time.Second, d.backoff(3))
+	assert.Equal(t, 5*time.Second, d.backoff(4))
+	assert.Equal(t, 5*time.Second, d.backoff(100))
+}
@@ -0,0 +1,55 @@
+// Package events publishes the events that the hero repositories add to the
+// outbox together with every change of a hero (see data.Event).
+package events
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"heroes.rainerstropek.com/internal/data"
+)
+
+// EventPublisher delivers events to other services. Publish returns an error
+// if the event might not have been delivered, it is retried later. Events
+// can therefore be delivered more than once.
+type EventPublisher interface {
+	Publish(ctx context.Context, event *data.Event) error
+}
+
+// Handler processes a published event within the process.
+type Handler func(ctx context.Context, event *data.Event) error
+
+// InProcessPublisher delivers events to handlers subscribed within the
+// process, one after the other. If any handler fails, the event is published
+// again later, also to the handlers that have already processed it.
+type InProcessPublisher struct {
+	mu       sync.RWMutex
+	handlers []Handler
+}
+
+func NewInProcessPublisher() *InProcessPublisher {
+	return &InProcessPublisher{}
+}
+
+func (p *InProcessPublisher) Subscribe(handler Handler) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.handlers = append(p.handlers, handler)
+}
+
+func (p *InProcessPublisher) Publish(ctx context.Context, event *data.Event) error {
+	p.mu.RLock()
+	handlers := p.handlers
+	p.mu.RUnlock()
+
+	var errs []error
+	for _, handler := range handlers {
+		if err := handler(ctx, event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,93 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"heroes.rainerstropek.com/internal/data"
+)
+
+// Headers of webhook requests
+const (
+	HeaderEventID   = "X-Hero-Event-Id"
+	HeaderEventType = "X-Hero-Event-Type"
+	HeaderSignature = "X-Hero-Signature-256"
+)
+
+// WebhookPublisher posts events as JSON to a URL. Every request is signed
+// with HMAC-SHA256 over the body using a shared secret, receivers check the
+// signature with VerifySignature. Any status but 2xx counts as a failure.
+type WebhookPublisher struct {
+	URL    string
+	Secret []byte
+	Client *http.Client
+}
+
+func NewWebhookPublisher(url string, secret []byte) *WebhookPublisher {
+	return &WebhookPublisher{
+		URL:    url,
+		Secret: secret,
+		Client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (p *WebhookPublisher) Publish(ctx context.Context, event *data.Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, p.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set(HeaderEventID, strconv.FormatInt(event.ID, 10))
+	r.Header.Set(HeaderEventType, event.Type)
+	r.Header.Set(HeaderSignature, Sign(p.Secret, body))
+
+	rs, err := p.Client.Do(r)
+	if err != nil {
+		return err
+	}
+
+	defer rs.Body.Close()
+
+	// Drain the body so that the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(rs.Body, 64*1024))
+
+	if rs.StatusCode < 200 || rs.StatusCode > 299 {
+		return fmt.Errorf("webhook responded with status %d", rs.StatusCode)
+	}
+
+	return nil
+}
+
+// Sign returns the signature of a webhook request body in the format of the
+// X-Hero-Signature-256 header ("sha256=" followed by the hex encoded HMAC).
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature checks the X-Hero-Signature-256 header of a webhook
+// request in constant time.
+func VerifySignature(secret, body []byte, signature string) bool {
+	if !strings.HasPrefix(signature, "sha256=") {
+		return false
+	}
+
+	return hmac.Equal([]byte(signature), []byte(Sign(secret, body)))
+}
@@ -0,0 +1,67 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"heroes.rainerstropek.com/internal/data"
+)
+
+func newTestEvent() *data.Event {
+	return &data.Event{
+		ID:         42,
+		Type:       data.EventHeroCreated,
+		HeroID:     1,
+		Version:    1,
+		Actor:      "test-user",
+		Hero:       json.RawMessage(`{"id":1,"name":"Superman"}`),
+		OccurredAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+}
+
+func TestWebhookPublisher(t *testing.T) {
+	secret := []byte("s3cr3t")
+
+	var received data.Event
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !VerifySignature(secret, body, r.Header.Get(HeaderSignature)) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		assert.Equal(t, "42", r.Header.Get(HeaderEventID))
+		assert.Equal(t, data.EventHeroCreated, r.Header.Get(HeaderEventType))
+		assert.NoError(t, json.Unmarshal(body, &received))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	err := NewWebhookPublisher(ts.URL, secret).Publish(context.Background(), newTestEvent())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(42), received.ID)
+	assert.JSONEq(t, `{"id":1,"name":"Superman"}`, string(received.Hero))
+
+	// A wrong secret is rejected by the receiver
+	err = NewWebhookPublisher(ts.URL, []byte("wrong")).Publish(context.Background(), newTestEvent())
+	assert.ErrorContains(t, err, "401")
+}
+
+func TestVerifySignature(t *testing.T) {
+	body := []byte(`{"id":1}`)
+	signature := Sign([]byte("secret"), body)
+
+	assert.True(t, VerifySignature([]byte("secret"), body, signature))
+	assert.False(t, VerifySignature([]byte("secret"), []byte(`{"id":2}`), signature))
+	assert.False(t, VerifySignature([]byte("secret"), body, ""))
+}
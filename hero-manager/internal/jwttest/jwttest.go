@@ -0,0 +1,69 @@
+// Package jwttest mints tokens signed with a fixture key so that the API can
+// be tested and run locally without an external identity provider.
+// NEVER accept tokens signed with the fixture key in production, its private
+// key is part of the source code.
+package jwttest
+
+import (
+	_ "embed"
+	"encoding/json"
+	"time"
+
+	jose "gopkg.in/go-jose/go-jose.v2"
+	"gopkg.in/go-jose/go-jose.v2/jwt"
+	"heroes.rainerstropek.com/internal/middleware"
+)
+
+const (
+	Issuer   = "https://heroes.test/"
+	Audience = "api://heroes-test"
+
+	// JWKSFile is the path of the public key set relative to the module root
+	JWKSFile = "internal/jwttest/testdata/jwks.json"
+)
+
+// JWKS contains the public key set for verifying minted tokens.
+//
+//go:embed testdata/jwks.json
+var JWKS string
+
+//go:embed testdata/private.jwk.json
+var privateKeyJSON []byte
+
+// Config returns a JWT configuration accepting tokens minted by Mint.
+func Config() middleware.JwtConfig {
+	return middleware.JwtConfig{
+		Issuer:     Issuer,
+		Audiences:  []string{Audience},
+		Algorithms: []string{string(jose.RS256)},
+		JWKS:       JWKS,
+	}
+}
+
+// Mint creates a token for subject that is valid for an hour.
+func Mint(subject string, claims middleware.CustomClaimsExample) (string, error) {
+	var key jose.JSONWebKey
+	err := json.Unmarshal(privateKeyJSON, &key)
+	if err != nil {
+		return "", err
+	}
+
+	signer, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.RS256, Key: key},
+		(&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", key.KeyID))
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	return jwt.Signed(signer).
+		Claims(jwt.Claims{
+			Issuer:   Issuer,
+			Subject:  subject,
+			Audience: jwt.Audience{Audience},
+			IssuedAt: jwt.NewNumericDate(now),
+			Expiry:   jwt.NewNumericDate(now.Add(time.Hour)),
+		}).
+		Claims(claims).
+		CompactSerialize()
+}
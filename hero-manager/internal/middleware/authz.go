@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	jwtmiddleware "github.com/auth0/go-jwt-middleware/v2"
+	v "github.com/auth0/go-jwt-middleware/v2/validator"
+)
+
+// Permissions that can be required by routes. They are granted by the scp
+// (delegated permissions) or roles (app roles) claim of the JWT.
+const (
+	PermissionHeroesRead  = "Heroes.Read"
+	PermissionHeroesWrite = "Heroes.Write"
+
+	// Admin is granted via the roles claim and implies all other permissions
+	PermissionAdmin = "Admin"
+)
+
+// Scopes returns the space-separated scopes of the scp claim.
+func (c *CustomClaimsExample) Scopes() []string {
+	return strings.Fields(c.Scope)
+}
+
+// HasPermission checks whether the claims grant the given permission.
+func (c *CustomClaimsExample) HasPermission(permission string) bool {
+	if slices.Contains(c.Roles, PermissionAdmin) {
+		return true
+	}
+
+	return slices.Contains(c.Scopes(), permission) || slices.Contains(c.Roles, permission)
+}
+
+// CustomClaims returns the custom claims of the validated JWT of the request.
+// ok is false if the request has not passed the JWT middleware.
+func CustomClaims(r *http.Request) (claims *CustomClaimsExample, ok bool) {
+	validated, ok := r.Context().Value(jwtmiddleware.ContextKey{}).(*v.ValidatedClaims)
+	if !ok {
+		return nil, false
+	}
+
+	claims, ok = validated.CustomClaims.(*CustomClaimsExample)
+	return claims, ok
+}
+
+// HasPermission checks whether the validated JWT of the request grants the given permission.
+func HasPermission(r *http.Request, permission string) bool {
+	claims, ok := CustomClaims(r)
+	return ok && claims.HasPermission(permission)
+}
@@ -2,21 +2,31 @@ package middleware
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
 	"net/url"
+	"os"
+	"strings"
 	"time"
 
 	jwtmiddleware "github.com/auth0/go-jwt-middleware/v2"
 	"github.com/auth0/go-jwt-middleware/v2/jwks"
 	v "github.com/auth0/go-jwt-middleware/v2/validator"
+	jose "gopkg.in/go-jose/go-jose.v2"
 )
 
 type CustomClaimsExample struct {
 	Name       string `json:"name"`
 	FamilyName string `json:"family_name"`
+
+	// Delegated permissions, space-separated (e.g. "Heroes.Read Heroes.Write")
+	Scope string `json:"scp,omitempty"`
+
+	// Application or app role permissions (e.g. ["Admin"])
+	Roles []string `json:"roles,omitempty"`
 }
 
 // Validate does nothing for this example.
@@ -24,32 +34,160 @@ func (c *CustomClaimsExample) Validate(ctx context.Context) error {
 	return nil
 }
 
-func NewJwtMiddleware(azureTenantId string, requiredScopes []string) *jwtmiddleware.JWTMiddleware {
-	issuerURL, err := url.Parse(fmt.Sprintf("https://login.microsoftonline.com/%s/", azureTenantId))
+// JwtConfig describes which tokens are accepted and where the keys to verify
+// their signatures come from. Keys are read from JWKS or JWKSFile if one of
+// them is set. Otherwise, they are fetched from the identity provider using
+// OpenID Connect discovery.
+type JwtConfig struct {
+	// Expected value of the iss claim
+	Issuer string
+
+	// Base URL for OpenID Connect discovery (defaults to Issuer)
+	DiscoveryURL string
+
+	// Accepted values of the aud claim
+	Audiences []string
+
+	// Accepted signature algorithms (defaults to RS256)
+	Algorithms []string
+
+	// Local JSON Web Key Set file
+	JWKSFile string
+
+	// Inline JSON Web Key Set, takes precedence over JWKSFile
+	JWKS string
+}
+
+// AzureJwtConfig returns the configuration for v1 access tokens issued by
+// Azure AD. Note that their issuer differs from the discovery URL.
+func AzureJwtConfig(azureTenantId string, audiences []string) JwtConfig {
+	return JwtConfig{
+		Issuer:       fmt.Sprintf("https://sts.windows.net/%s/", azureTenantId),
+		DiscoveryURL: fmt.Sprintf("https://login.microsoftonline.com/%s/", azureTenantId),
+		Audiences:    audiences,
+		Algorithms:   []string{string(v.RS256)},
+	}
+}
+
+// keyFunc returns the function providing the keys for signature verification.
+func (cfg JwtConfig) keyFunc() (func(context.Context) (interface{}, error), error) {
+	var keySetJSON []byte
+	switch {
+	case cfg.JWKS != "":
+		keySetJSON = []byte(cfg.JWKS)
+	case cfg.JWKSFile != "":
+		var err error
+		keySetJSON, err = os.ReadFile(cfg.JWKSFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the JWKS file: %w", err)
+		}
+	default:
+		discoveryURL := cfg.DiscoveryURL
+		if discoveryURL == "" {
+			discoveryURL = cfg.Issuer
+		}
+
+		issuerURL, err := url.Parse(discoveryURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse the discovery url: %w", err)
+		}
+
+		provider := jwks.NewCachingProvider(issuerURL, 5*time.Minute)
+		return provider.KeyFunc, nil
+	}
+
+	var keySet jose.JSONWebKeySet
+	err := json.Unmarshal(keySetJSON, &keySet)
 	if err != nil {
-		log.Fatalf("failed to parse the issuer url: %v", err)
+		return nil, fmt.Errorf("failed to parse the JWKS: %w", err)
 	}
 
-	provider := jwks.NewCachingProvider(issuerURL, 5*time.Minute)
-	customClaims := &CustomClaimsExample{}
-	jwtValidator, _ := v.New(
-		provider.KeyFunc,
-		"RS256",
-		fmt.Sprintf("https://sts.windows.net/%s/", azureTenantId),
-		requiredScopes,
-		v.WithCustomClaims(func () v.CustomClaims { return customClaims }))
-	return jwtmiddleware.New(jwtValidator.ValidateToken)
+	if len(keySet.Keys) == 0 {
+		return nil, errors.New("the JWKS does not contain any keys")
+	}
+
+	return func(ctx context.Context) (interface{}, error) { return &keySet, nil }, nil
 }
 
-func ClaimsHandler(w http.ResponseWriter, r *http.Request) {
-	claims := r.Context().Value(jwtmiddleware.ContextKey{}).(*v.ValidatedClaims)
+// NewJwtMiddleware creates a middleware validating bearer tokens according to cfg.
+func NewJwtMiddleware(cfg JwtConfig, opts ...jwtmiddleware.Option) (*jwtmiddleware.JWTMiddleware, error) {
+	keyFunc, err := cfg.keyFunc()
+	if err != nil {
+		return nil, err
+	}
 
-	payload, err := json.Marshal(claims)
+	algorithms := cfg.Algorithms
+	if len(algorithms) == 0 {
+		algorithms = []string{string(v.RS256)}
+	}
+
+	// The validator supports a single algorithm, so we need one per algorithm
+	validators := make(map[string]*v.Validator)
+	for _, algorithm := range algorithms {
+		validator, err := v.New(
+			keyFunc,
+			v.SignatureAlgorithm(algorithm),
+			cfg.Issuer,
+			cfg.Audiences,
+			// Every token needs its own claims instance, they must not be shared between requests
+			v.WithCustomClaims(func() v.CustomClaims { return &CustomClaimsExample{} }))
+		if err != nil {
+			return nil, fmt.Errorf("invalid JWT configuration for %s: %w", algorithm, err)
+		}
+
+		validators[algorithm] = validator
+	}
+
+	validateToken := func(ctx context.Context, token string) (interface{}, error) {
+		alg, err := tokenAlgorithm(token)
+		if err != nil {
+			return nil, err
+		}
+
+		validator, ok := validators[alg]
+		if !ok {
+			return nil, fmt.Errorf("signature algorithm %q is not allowed", alg)
+		}
+
+		return validator.ValidateToken(ctx, token)
+	}
+
+	return jwtmiddleware.New(validateToken, opts...), nil
+}
+
+// tokenAlgorithm reads the alg header of a compact serialized JWT without verifying it.
+func tokenAlgorithm(token string) (string, error) {
+	header, _, _ := strings.Cut(token, ".")
+	js, err := base64.RawURLEncoding.DecodeString(header)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return "", fmt.Errorf("could not parse the token header: %w", err)
+	}
+
+	var h struct {
+		Algorithm string `json:"alg"`
+	}
+	err = json.Unmarshal(js, &h)
+	if err != nil {
+		return "", fmt.Errorf("could not parse the token header: %w", err)
+	}
+
+	return h.Algorithm, nil
+}
+
+// Claims returns the validated JWT claims of the request. ok is false if the
+// request has not passed the JWT middleware.
+func Claims(r *http.Request) (claims *v.ValidatedClaims, ok bool) {
+	claims, ok = r.Context().Value(jwtmiddleware.ContextKey{}).(*v.ValidatedClaims)
+	return claims, ok
+}
+
+// Subject returns the subject of the validated JWT of the request. ok is false
+// if the request has not passed the JWT middleware.
+func Subject(r *http.Request) (subject string, ok bool) {
+	claims, ok := Claims(r)
+	if !ok {
+		return "", false
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(payload)
+	return claims.RegisteredClaims.Subject, true
 }
@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewJwtMiddlewareInvalidConfig(t *testing.T) {
+	valid := JwtConfig{
+		Issuer:    "https://issuer.test/",
+		Audiences: []string{"api://heroes"},
+		JWKS:      `{"keys": [{"kty": "oct", "k": "c2VjcmV0", "kid": "test"}]}`,
+	}
+
+	_, err := NewJwtMiddleware(valid)
+	assert.NoError(t, err)
+
+	cfg := valid
+	cfg.JWKS = `{"keys": []}`
+	_, err = NewJwtMiddleware(cfg)
+	assert.Error(t, err)
+
+	cfg = valid
+	cfg.Audiences = nil
+	_, err = NewJwtMiddleware(cfg)
+	assert.Error(t, err)
+
+	cfg = valid
+	cfg.Algorithms = []string{"none"}
+	_, err = NewJwtMiddleware(cfg)
+	assert.Error(t, err)
+}
+
+func TestTokenAlgorithm(t *testing.T) {
+	// {"alg":"HS256","typ":"JWT"}
+	alg, err := tokenAlgorithm("eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9.e30.sig")
+	assert.NoError(t, err)
+	assert.Equal(t, "HS256", alg)
+
+	_, err = tokenAlgorithm("not-a-jwt")
+	assert.Error(t, err)
+}
@@ -0,0 +1,58 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"heroes.rainerstropek.com/migrations"
+)
+
+func TestReadMigrationsSortsByVersion(t *testing.T) {
+	fsys := fstest.MapFS{
+		"000010_second.up.sql":   {Data: []byte("up 10")},
+		"000010_second.down.sql": {Data: []byte("down 10")},
+		"000002_first.up.sql":    {Data: []byte("up 2")},
+		"000002_first.down.sql":  {Data: []byte("down 2")},
+		"readme.md":              {Data: []byte("ignored")},
+	}
+
+	m, err := readMigrations(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, []Migration{
+		{Version: 2, Name: "first", Up: "up 2", Down: "down 2"},
+		{Version: 10, Name: "second", Up: "up 10", Down: "down 10"},
+	}, m)
+}
+
+func TestReadMigrationsMissingScript(t *testing.T) {
+	fsys := fstest.MapFS{
+		"000001_first.up.sql": {Data: []byte("up 1")},
+	}
+
+	_, err := readMigrations(fsys)
+	assert.True(t, errors.Is(err, ErrMissingScript))
+}
+
+func TestEmbeddedMigrationsAreComplete(t *testing.T) {
+	m, err := readMigrations(migrations.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.NotEmpty(t, m)
+	assert.Equal(t, int64(1), m[0].Version)
+}
+
+func TestDownRequiresSteps(t *testing.T) {
+	m := &Migrator{}
+
+	reverted, err := m.Down(context.Background(), 0)
+	assert.Error(t, err)
+	assert.Empty(t, reverted)
+}
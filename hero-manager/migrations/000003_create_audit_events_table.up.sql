@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS audit_events (
+    id bigserial PRIMARY KEY,
+    hero_id bigint NOT NULL,
+    action text NOT NULL,
+    actor text NOT NULL,
+    version integer NOT NULL,
+    changes jsonb NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS audit_events_hero_id_idx ON audit_events (hero_id, id);
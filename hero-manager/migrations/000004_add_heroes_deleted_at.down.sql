@@ -0,0 +1 @@
+ALTER TABLE heroes DROP COLUMN IF EXISTS deleted_at;
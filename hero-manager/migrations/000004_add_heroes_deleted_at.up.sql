@@ -0,0 +1 @@
+ALTER TABLE heroes ADD COLUMN IF NOT EXISTS deleted_at timestamp(0) with time zone;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS heroes_search_idx;
+DROP FUNCTION IF EXISTS heroes_search_document(text, text, text[]);
@@ -0,0 +1,10 @@
+-- Full-text search document of a hero. array_to_string is not immutable,
+-- the wrapper is, so that the document can be indexed.
+CREATE OR REPLACE FUNCTION heroes_search_document(name text, realname text, abilities text[])
+RETURNS tsvector
+LANGUAGE sql IMMUTABLE PARALLEL SAFE
+AS $$
+    SELECT to_tsvector('simple', coalesce(name, '') || ' ' || coalesce(realname, '') || ' ' || coalesce(array_to_string(abilities, ' '), ''))
+$$;
+
+CREATE INDEX IF NOT EXISTS heroes_search_idx ON heroes USING GIN (heroes_search_document(name, realname, abilities));
@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS teams (
+    id bigserial PRIMARY KEY,
+    name text NOT NULL,
+    description text NOT NULL DEFAULT '',
+    version integer NOT NULL DEFAULT 1
+);
+
+CREATE TABLE IF NOT EXISTS team_members (
+    team_id bigint NOT NULL REFERENCES teams ON DELETE CASCADE,
+    hero_id bigint NOT NULL REFERENCES heroes ON DELETE CASCADE,
+    PRIMARY KEY (team_id, hero_id)
+);
+CREATE INDEX IF NOT EXISTS team_members_hero_id_idx ON team_members (hero_id);
+
+-- Rivalries are symmetric, every pair of heroes is stored once
+CREATE TABLE IF NOT EXISTS rivalries (
+    hero_id bigint NOT NULL REFERENCES heroes ON DELETE CASCADE,
+    rival_id bigint NOT NULL REFERENCES heroes ON DELETE CASCADE,
+    PRIMARY KEY (hero_id, rival_id),
+    CHECK (hero_id < rival_id)
+);
+CREATE INDEX IF NOT EXISTS rivalries_rival_id_idx ON rivalries (rival_id);
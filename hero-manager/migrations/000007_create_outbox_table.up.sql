@@ -0,0 +1,15 @@
+-- Events are written together with the change of a hero and deleted once
+-- they have been published
+CREATE TABLE IF NOT EXISTS outbox (
+    id bigserial PRIMARY KEY,
+    type text NOT NULL,
+    hero_id bigint NOT NULL,
+    version integer NOT NULL,
+    actor text NOT NULL,
+    payload jsonb NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    attempts integer NOT NULL DEFAULT 0,
+    next_attempt_at timestamp with time zone NOT NULL DEFAULT NOW(),
+    last_error text NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS outbox_next_attempt_at_idx ON outbox (next_attempt_at, id);
@@ -0,0 +1,13 @@
+-- Responses of requests carrying an Idempotency-Key, status is 0 while the
+-- request is processed
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    subject text NOT NULL,
+    key text NOT NULL,
+    fingerprint text NOT NULL,
+    status integer NOT NULL DEFAULT 0,
+    header jsonb NOT NULL DEFAULT '{}',
+    body bytea NOT NULL DEFAULT '',
+    expires_at timestamp with time zone NOT NULL,
+    PRIMARY KEY (subject, key)
+);
+CREATE INDEX IF NOT EXISTS idempotency_keys_expires_at_idx ON idempotency_keys (expires_at);
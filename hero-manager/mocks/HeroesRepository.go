@@ -3,6 +3,8 @@
 package mocks
 
 import (
+	context "context"
+
 	mock "github.com/stretchr/testify/mock"
 	data "heroes.rainerstropek.com/internal/data"
 )
@@ -12,13 +14,166 @@ type HeroesRepository struct {
 	mock.Mock
 }
 
-// Delete provides a mock function with given fields: id
-func (_m *HeroesRepository) Delete(id int64) error {
-	ret := _m.Called(id)
+// AddRival provides a mock function with given fields: ctx, heroID, rivalID
+func (_m *HeroesRepository) AddRival(ctx context.Context, heroID int64, rivalID int64) error {
+	ret := _m.Called(ctx, heroID, rivalID)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, int64, int64) error); ok {
+		r0 = rf(ctx, heroID, rivalID)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Delete provides a mock function with given fields: ctx, id
+func (_m *HeroesRepository) Delete(ctx context.Context, id int64) error {
+	ret := _m.Called(ctx, id)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, int64) error); ok {
+		r0 = rf(ctx, id)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Get provides a mock function with given fields: ctx, id
+func (_m *HeroesRepository) Get(ctx context.Context, id int64) (*data.Hero, error) {
+	ret := _m.Called(ctx, id)
+
+	var r0 *data.Hero
+	if rf, ok := ret.Get(0).(func(context.Context, int64) *data.Hero); ok {
+		r0 = rf(ctx, id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*data.Hero)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, int64) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetAll provides a mock function with given fields: ctx, heroFilter, filters
+func (_m *HeroesRepository) GetAll(ctx context.Context, heroFilter data.HeroFilter, filters data.Filters) ([]*data.Hero, data.Metadata, error) {
+	ret := _m.Called(ctx, heroFilter, filters)
+
+	var r0 []*data.Hero
+	if rf, ok := ret.Get(0).(func(context.Context, data.HeroFilter, data.Filters) []*data.Hero); ok {
+		r0 = rf(ctx, heroFilter, filters)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*data.Hero)
+		}
+	}
+
+	var r1 data.Metadata
+	if rf, ok := ret.Get(1).(func(context.Context, data.HeroFilter, data.Filters) data.Metadata); ok {
+		r1 = rf(ctx, heroFilter, filters)
+	} else {
+		r1 = ret.Get(1).(data.Metadata)
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(context.Context, data.HeroFilter, data.Filters) error); ok {
+		r2 = rf(ctx, heroFilter, filters)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
+// History provides a mock function with given fields: ctx, heroID, filters
+func (_m *HeroesRepository) History(ctx context.Context, heroID int64, filters data.Filters) ([]*data.AuditEvent, data.Metadata, error) {
+	ret := _m.Called(ctx, heroID, filters)
+
+	var r0 []*data.AuditEvent
+	if rf, ok := ret.Get(0).(func(context.Context, int64, data.Filters) []*data.AuditEvent); ok {
+		r0 = rf(ctx, heroID, filters)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*data.AuditEvent)
+		}
+	}
+
+	var r1 data.Metadata
+	if rf, ok := ret.Get(1).(func(context.Context, int64, data.Filters) data.Metadata); ok {
+		r1 = rf(ctx, heroID, filters)
+	} else {
+		r1 = ret.Get(1).(data.Metadata)
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(context.Context, int64, data.Filters) error); ok {
+		r2 = rf(ctx, heroID, filters)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
+// Insert provides a mock function with given fields: ctx, hero
+func (_m *HeroesRepository) Insert(ctx context.Context, hero *data.Hero) error {
+	ret := _m.Called(ctx, hero)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *data.Hero) error); ok {
+		r0 = rf(ctx, hero)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// InsertMany provides a mock function with given fields: ctx, heroes
+func (_m *HeroesRepository) InsertMany(ctx context.Context, heroes []*data.Hero) error {
+	ret := _m.Called(ctx, heroes)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, []*data.Hero) error); ok {
+		r0 = rf(ctx, heroes)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Purge provides a mock function with given fields: ctx, id
+func (_m *HeroesRepository) Purge(ctx context.Context, id int64) error {
+	ret := _m.Called(ctx, id)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, int64) error); ok {
+		r0 = rf(ctx, id)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RemoveRival provides a mock function with given fields: ctx, heroID, rivalID
+func (_m *HeroesRepository) RemoveRival(ctx context.Context, heroID int64, rivalID int64) error {
+	ret := _m.Called(ctx, heroID, rivalID)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(int64) error); ok {
-		r0 = rf(id)
+	if rf, ok := ret.Get(0).(func(context.Context, int64, int64) error); ok {
+		r0 = rf(ctx, heroID, rivalID)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -26,13 +181,13 @@ func (_m *HeroesRepository) Delete(id int64) error {
 	return r0
 }
 
-// Get provides a mock function with given fields: id
-func (_m *HeroesRepository) Get(id int64) (*data.Hero, error) {
-	ret := _m.Called(id)
+// Restore provides a mock function with given fields: ctx, id
+func (_m *HeroesRepository) Restore(ctx context.Context, id int64) (*data.Hero, error) {
+	ret := _m.Called(ctx, id)
 
 	var r0 *data.Hero
-	if rf, ok := ret.Get(0).(func(int64) *data.Hero); ok {
-		r0 = rf(id)
+	if rf, ok := ret.Get(0).(func(context.Context, int64) *data.Hero); ok {
+		r0 = rf(ctx, id)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(*data.Hero)
@@ -40,8 +195,8 @@ func (_m *HeroesRepository) Get(id int64) (*data.Hero, error) {
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(int64) error); ok {
-		r1 = rf(id)
+	if rf, ok := ret.Get(1).(func(context.Context, int64) error); ok {
+		r1 = rf(ctx, id)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -49,13 +204,13 @@ func (_m *HeroesRepository) Get(id int64) (*data.Hero, error) {
 	return r0, r1
 }
 
-// GetAll provides a mock function with given fields: name, abilities, filters
-func (_m *HeroesRepository) GetAll(name string, abilities []string, filters data.Filters) ([]*data.Hero, error) {
-	ret := _m.Called(name, abilities, filters)
+// Rivals provides a mock function with given fields: ctx, heroID
+func (_m *HeroesRepository) Rivals(ctx context.Context, heroID int64) ([]*data.Hero, error) {
+	ret := _m.Called(ctx, heroID)
 
 	var r0 []*data.Hero
-	if rf, ok := ret.Get(0).(func(string, []string, data.Filters) []*data.Hero); ok {
-		r0 = rf(name, abilities, filters)
+	if rf, ok := ret.Get(0).(func(context.Context, int64) []*data.Hero); ok {
+		r0 = rf(ctx, heroID)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).([]*data.Hero)
@@ -63,8 +218,8 @@ func (_m *HeroesRepository) GetAll(name string, abilities []string, filters data
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(string, []string, data.Filters) error); ok {
-		r1 = rf(name, abilities, filters)
+	if rf, ok := ret.Get(1).(func(context.Context, int64) error); ok {
+		r1 = rf(ctx, heroID)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -72,13 +227,13 @@ func (_m *HeroesRepository) GetAll(name string, abilities []string, filters data
 	return r0, r1
 }
 
-// Insert provides a mock function with given fields: hero
-func (_m *HeroesRepository) Insert(hero *data.Hero) error {
-	ret := _m.Called(hero)
+// Stream provides a mock function with given fields: ctx, heroFilter, filters, fn
+func (_m *HeroesRepository) Stream(ctx context.Context, heroFilter data.HeroFilter, filters data.Filters, fn func(*data.Hero) error) error {
+	ret := _m.Called(ctx, heroFilter, filters, fn)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(*data.Hero) error); ok {
-		r0 = rf(hero)
+	if rf, ok := ret.Get(0).(func(context.Context, data.HeroFilter, data.Filters, func(*data.Hero) error) error); ok {
+		r0 = rf(ctx, heroFilter, filters, fn)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -86,13 +241,13 @@ func (_m *HeroesRepository) Insert(hero *data.Hero) error {
 	return r0
 }
 
-// Update provides a mock function with given fields: hero
-func (_m *HeroesRepository) Update(hero *data.Hero) error {
-	ret := _m.Called(hero)
+// Update provides a mock function with given fields: ctx, hero
+func (_m *HeroesRepository) Update(ctx context.Context, hero *data.Hero) error {
+	ret := _m.Called(ctx, hero)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(*data.Hero) error); ok {
-		r0 = rf(hero)
+	if rf, ok := ret.Get(0).(func(context.Context, *data.Hero) error); ok {
+		r0 = rf(ctx, hero)
 	} else {
 		r0 = ret.Error(0)
 	}